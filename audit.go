@@ -0,0 +1,330 @@
+package fuse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/command"
+	"github.com/sylvrs/fuse/component"
+	"github.com/sylvrs/fuse/tracing"
+	"github.com/sylvrs/fuse/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultAuditRetention is how long audit entries are kept when no retention is configured
+	DefaultAuditRetention = 90 * 24 * time.Hour
+	auditCommandName      = "audit"
+	auditEntriesPerPage   = 10
+	// maxAuditPageLength is the maximum length of an embed description allowed by Discord
+	maxAuditPageLength = 4096
+	// maxAuditEntryLength keeps a full page of entries within maxAuditPageLength
+	maxAuditEntryLength = maxAuditPageLength/auditEntriesPerPage - 1
+)
+
+// AuditEntry is the database representation of an action performed by the bot
+type AuditEntry struct {
+	ID uint `gorm:"primaryKey"`
+	// GuildID is the ID of the guild the action was performed in
+	GuildID string `gorm:"index"`
+	// ActorID is the ID of the user who triggered the action, or empty if the bot acted on its own
+	ActorID string `gorm:"index"`
+	// Action is a short name for the action, e.g. "role.add" or "settings.update"
+	Action string `gorm:"index"`
+	// TargetType is the kind of the target of the action, e.g. "member" or "message"
+	TargetType string
+	// TargetID is the ID of the target of the action
+	TargetID string `gorm:"index"`
+	// Before and After are the JSON-encoded values before and after the action, if any
+	Before string `gorm:"type:TEXT"`
+	After  string `gorm:"type:TEXT"`
+	// Reason is the reason given for the action, if any
+	Reason string
+	// InteractionID and ChannelID identify the interaction that triggered the action, if any
+	InteractionID string
+	ChannelID     string
+	CreatedAt     time.Time `gorm:"index"`
+}
+
+// AuditEvent describes an action to record in the audit log
+type AuditEvent struct {
+	// ActorID is the ID of the user who triggered the action
+	// If empty, the user of the interaction is used
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	// Before and After are the values before and after the action and are stored as JSON
+	Before interface{}
+	After  interface{}
+	Reason string
+	// Interaction is the interaction that triggered the action, if any
+	Interaction *discordgo.Interaction
+}
+
+// AuditQuery filters the entries returned from the audit log
+// Empty fields are not used as filters
+type AuditQuery struct {
+	ActorID  string
+	Action   string
+	TargetID string
+	Since    time.Time
+	Until    time.Time
+	// Limit is the maximum number of entries to return, all entries are returned if zero
+	Limit  int
+	Offset int
+}
+
+// Audit records an action in the guild's audit log and logs it to the guild's logger
+func (mng *GuildManager) Audit(event AuditEvent) (*AuditEntry, error) {
+	return mng.AuditContext(context.Background(), event)
+}
+
+// AuditContext records an action like Audit
+// The database query uses ctx and is traced as part of the span in ctx, e.g. the one of an interaction
+func (mng *GuildManager) AuditContext(ctx context.Context, event AuditEvent) (_ *AuditEntry, err error) {
+	if event.Action == "" {
+		return nil, errors.New("audit event has no action")
+	}
+	ctx, span := tracing.Start(ctx, "audit", "audit.action", event.Action)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	entry := &AuditEntry{
+		GuildID:    mng.guild.ID,
+		ActorID:    event.ActorID,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		Reason:     event.Reason,
+	}
+	if event.Interaction != nil {
+		entry.InteractionID = event.Interaction.ID
+		entry.ChannelID = event.Interaction.ChannelID
+		if user := utils.InteractionUser(event.Interaction); entry.ActorID == "" && user != nil {
+			entry.ActorID = user.ID
+		}
+	}
+	if entry.Before, err = auditValue(event.Before); err != nil {
+		return nil, err
+	}
+	if entry.After, err = auditValue(event.After); err != nil {
+		return nil, err
+	}
+	if err := mng.Connection().WithContext(ctx).Create(entry).Error; err != nil {
+		return nil, err
+	}
+	mng.logger.Info(fmt.Sprintf("Audit: %s", entry.Action), "actor", entry.ActorID, "target", entry.TargetID, "reason", entry.Reason)
+	return entry, nil
+}
+
+// auditValue encodes a before or after value of an audit event
+func auditValue(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit value: %w", err)
+	}
+	return string(raw), nil
+}
+
+// AuditEntries returns the guild's audit entries matching the query, newest first
+func (mng *GuildManager) AuditEntries(query AuditQuery) ([]AuditEntry, error) {
+	return mng.AuditEntriesContext(context.Background(), query)
+}
+
+// AuditEntriesContext returns the guild's audit entries like AuditEntries, using ctx for the database query
+func (mng *GuildManager) AuditEntriesContext(ctx context.Context, query AuditQuery) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	db := mng.auditScope(ctx, query).Order("created_at DESC, id DESC").Offset(query.Offset)
+	if query.Limit > 0 {
+		db = db.Limit(query.Limit)
+	}
+	if err := db.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// CountAuditEntries returns the number of the guild's audit entries matching the query, ignoring its limit and offset
+func (mng *GuildManager) CountAuditEntries(query AuditQuery) (int64, error) {
+	return mng.CountAuditEntriesContext(context.Background(), query)
+}
+
+// CountAuditEntriesContext counts the guild's audit entries like CountAuditEntries, using ctx for the database query
+func (mng *GuildManager) CountAuditEntriesContext(ctx context.Context, query AuditQuery) (int64, error) {
+	var count int64
+	if err := mng.auditScope(ctx, query).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// auditScope returns the statement selecting the guild's audit entries matching the query
+func (mng *GuildManager) auditScope(ctx context.Context, query AuditQuery) *gorm.DB {
+	db := mng.Connection().WithContext(ctx).Model(&AuditEntry{}).Where("guild_id = ?", mng.guild.ID)
+	if query.ActorID != "" {
+		db = db.Where("actor_id = ?", query.ActorID)
+	}
+	if query.Action != "" {
+		db = db.Where("action = ?", query.Action)
+	}
+	if query.TargetID != "" {
+		db = db.Where("target_id = ?", query.TargetID)
+	}
+	if !query.Since.IsZero() {
+		db = db.Where("created_at >= ?", query.Since)
+	}
+	if !query.Until.IsZero() {
+		db = db.Where("created_at < ?", query.Until)
+	}
+	return db
+}
+
+// auditRetention returns the configured retention period for audit entries
+func (mng *Manager) auditRetention() time.Duration {
+	if mng.config.AuditRetention == 0 {
+		return DefaultAuditRetention
+	}
+	return mng.config.AuditRetention
+}
+
+// purgeExpiredAuditEntries removes every audit entry older than the retention period
+func (mng *Manager) purgeExpiredAuditEntries() {
+	retention := mng.auditRetention()
+	if retention < 0 {
+		return
+	}
+	result := mng.connection.Where("created_at < ?", time.Now().Add(-retention)).Delete(&AuditEntry{})
+	if result.Error != nil {
+		mng.logger.Error("Failed to purge expired audit entries", "error", result.Error)
+		return
+	}
+	if result.RowsAffected != 0 {
+		mng.logger.Debug("Purged expired audit entries", "count", result.RowsAffected)
+	}
+}
+
+// recordAudit records an action in the audit log, logging failures instead of failing the audited action
+// The entry is recorded as part of the interaction the event was triggered by, if it is still being handled
+func (mng *GuildManager) recordAudit(event AuditEvent) {
+	ctx := context.Background()
+	if event.Interaction != nil {
+		ctx = mng.manager.interactionContext(event.Interaction.ID)
+	}
+	if _, err := mng.AuditContext(ctx, event); err != nil {
+		mng.logger.Error("Failed to record audit entry", "action", event.Action, "error", err)
+	}
+}
+
+func (mng *GuildManager) registerAuditCommand() {
+	permission := int64(discordgo.PermissionAdministrator)
+	minDays := 1.0
+	mng.commandHandler.Register(&command.Command{
+		Name:               auditCommandName,
+		Description:        "Show the actions performed by the bot in this server",
+		DefaultPermissions: &permission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "user",
+				Description: "Only show actions triggered by this user",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "action",
+				Description: "Only show actions of this kind, e.g. settings.update",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "target",
+				Description: "Only show actions on the target with this ID",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "days",
+				Description: "Only show actions from the last number of days",
+				MinValue:    &minDays,
+			},
+		},
+		ContextHandler: func(ctx context.Context, _ *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+			return mng.handleAuditCommand(ctx, i)
+		},
+	})
+}
+
+func (mng *GuildManager) handleAuditCommand(ctx context.Context, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	query := AuditQuery{Limit: auditEntriesPerPage}
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "user":
+			query.ActorID = option.UserValue(nil).ID
+		case "action":
+			query.Action = option.StringValue()
+		case "target":
+			query.TargetID = option.StringValue()
+		case "days":
+			query.Since = time.Now().AddDate(0, 0, -int(option.IntValue()))
+		}
+	}
+	count, err := mng.CountAuditEntriesContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	pages := int((count + auditEntriesPerPage - 1) / auditEntriesPerPage)
+	paginator := &component.Paginator{Pages: pages, Ephemeral: true}
+	paginator.RenderContext = func(ctx context.Context, page int) (*discordgo.MessageEmbed, error) {
+		pageQuery := query
+		pageQuery.Offset = page * auditEntriesPerPage
+		entries, err := mng.AuditEntriesContext(ctx, pageQuery)
+		if err != nil {
+			return nil, err
+		}
+		return &discordgo.MessageEmbed{
+			Title:       "Audit Log",
+			Description: formatAuditPage(entries),
+			Color:       utils.ColorPrimary,
+		}, nil
+	}
+	return mng.Paginate(i, paginator)
+}
+
+// formatAuditPage formats the entries as the lines of a single page, leaving out any that would not fit in an embed
+func formatAuditPage(entries []AuditEntry) string {
+	lines := make([]string, 0, len(entries))
+	length := 0
+	for _, entry := range entries {
+		line := utils.Truncate(formatAuditEntry(entry), maxAuditEntryLength)
+		if length+utf8.RuneCountInString(line)+1 > maxAuditPageLength {
+			break
+		}
+		lines = append(lines, line)
+		length += utf8.RuneCountInString(line) + 1
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatAuditEntry formats the entry as a single line of the audit log
+func formatAuditEntry(entry AuditEntry) string {
+	actor := utils.IfElse(entry.ActorID == "", "The bot", fmt.Sprintf("<@%s>", entry.ActorID))
+	line := fmt.Sprintf("<t:%d:f> %s **%s**", entry.CreatedAt.Unix(), actor, entry.Action)
+	if entry.TargetType != "" {
+		line += " " + entry.TargetType
+	}
+	if entry.TargetID != "" {
+		line += fmt.Sprintf(" `%s`", entry.TargetID)
+	}
+	if entry.Reason != "" {
+		line += fmt.Sprintf(" (%s)", entry.Reason)
+	}
+	return line
+}
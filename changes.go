@@ -0,0 +1,95 @@
+package fuse
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/sylvrs/fuse/notify"
+	"gorm.io/gorm"
+)
+
+// onChange is called for every event received from the change bus
+// Events published by this manager are ignored as its caches are already up to date
+func (mng *Manager) onChange(event notify.Event) {
+	if event.Origin == mng.origin {
+		return
+	}
+	guildManager, err := mng.GuildManager(event.GuildID)
+	if err != nil {
+		return
+	}
+	switch event.Kind {
+	case notify.KindServiceConfig:
+		if err := guildManager.invalidateTable(event.Table); err != nil {
+			mng.logger.Error("Failed to write pending service configuration before refreshing it", "guild", event.GuildID, "table", event.Table, "error", err)
+		}
+		mng.logger.Debug("Refreshed service configuration after remote change", "guild", event.GuildID, "table", event.Table)
+		// services may have been enabled or disabled by the change
+		if err := guildManager.RefreshServices(); err != nil {
+			mng.logger.Error("Failed to refresh services after remote change", "guild", event.GuildID, "error", err)
+		}
+	case notify.KindGuildConfig:
+		if err := guildManager.reloadConfig(); err != nil {
+			mng.logger.Error("Failed to reload guild configuration", "guild", event.GuildID, "error", err)
+			return
+		}
+		mng.logger.Debug("Reloaded guild configuration after remote change", "guild", event.GuildID)
+	}
+}
+
+// tableName returns the name of the database table used for the provided model
+func (mng *Manager) tableName(model interface{}) (string, error) {
+	statement := &gorm.Statement{DB: mng.connection}
+	if err := statement.Parse(model); err != nil {
+		return "", err
+	}
+	return statement.Schema.Table, nil
+}
+
+// publishChange notifies other processes that data for the guild has changed
+func (mng *GuildManager) publishChange(kind notify.Kind, model interface{}) {
+	event := notify.Event{Kind: kind, GuildID: mng.guild.ID, Origin: mng.manager.origin}
+	if model != nil {
+		table, err := mng.manager.tableName(model)
+		if err != nil {
+			mng.logger.Error("Failed to resolve table for change event", "error", err)
+			return
+		}
+		event.Table = table
+	}
+	if err := mng.manager.bus.Publish(event); err != nil {
+		mng.logger.Error("Failed to publish change event", "kind", kind, "error", err)
+	}
+}
+
+// invalidateTable removes the cached service configuration stored in the provided table
+// If the table is empty, every cached configuration is removed
+// Pending write-behind changes are written first, so they either apply on top of the remote change or fail as a conflict
+func (mng *GuildManager) invalidateTable(table string) error {
+	if table == "" {
+		return mng.InvalidateServiceConfigs()
+	}
+	var errs []error
+	for _, t := range mng.configs.types() {
+		if name, err := mng.manager.tableName(reflect.New(t).Interface()); err == nil && name == table {
+			errs = append(errs, mng.invalidateConfigType(t))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reloadConfig reads the built-in guild configuration from the database again
+func (mng *GuildManager) reloadConfig() error {
+	var config GuildConfiguration
+	if err := mng.Connection().Where("guild_id = ?", mng.guild.ID).First(&config).Error; err != nil {
+		return err
+	}
+	mng.configMutex.Lock()
+	logChanged := config.LogChannelID != mng.config.LogChannelID || config.LogLevel != mng.config.LogLevel
+	*mng.config = config
+	mng.configMutex.Unlock()
+	if logChanged {
+		mng.applyLogChannel()
+	}
+	return nil
+}
@@ -1,17 +1,49 @@
 package command
 
-import "github.com/bwmarrin/discordgo"
+import (
+	"context"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// HandlerFunc handles a command
+type HandlerFunc func(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error)
+
+// ContextHandlerFunc handles a command with the context of its interaction
+// The context carries request-scoped values such as the invoking member and is cancelled once the handler returns, unless it is kept alive with fuse.KeepAlive
+type ContextHandlerFunc func(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error)
+
+// Adapt adapts a handler that does not take a context so that it can be used wherever a ContextHandlerFunc is expected
+func Adapt(handler HandlerFunc) ContextHandlerFunc {
+	return func(_ context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+		return handler(s, i)
+	}
+}
 
 type Command struct {
+	// Type is the type of the command, a chat input (slash) command if zero
+	// User and message commands are shown in context menus and must not have a description or options
+	Type               discordgo.ApplicationCommandType
 	Name               string
 	Description        string
 	DefaultPermissions *int64
 	Options            []*discordgo.ApplicationCommandOption
-	Handler            func(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error)
+	Handler            HandlerFunc
+	// ContextHandler is used instead of Handler if set
+	ContextHandler ContextHandlerFunc
+}
+
+// handler returns the handler of the command, adapting Handler if no context handler is set
+func (c *Command) handler() ContextHandlerFunc {
+	if c.ContextHandler != nil {
+		return c.ContextHandler
+	}
+	return Adapt(c.Handler)
 }
 
 func (c *Command) ApplicationCommand() *discordgo.ApplicationCommand {
 	return &discordgo.ApplicationCommand{
+		Type:                     c.Type,
 		Name:                     c.Name,
 		Description:              c.Description,
 		DefaultMemberPermissions: c.DefaultPermissions,
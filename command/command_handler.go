@@ -1,6 +1,7 @@
 package command
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/bwmarrin/discordgo"
@@ -75,9 +76,14 @@ func (c *CommandHandler) Deinit() error {
 }
 
 func (c *CommandHandler) Handle(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	return c.HandleContext(context.Background(), s, i)
+}
+
+// HandleContext handles the command with the context of its interaction
+func (c *CommandHandler) HandleContext(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
 	command, ok := c.commands[i.ApplicationCommandData().Name]
 	if !ok {
 		return nil, fmt.Errorf("command `%s` not found", i.ApplicationCommandData().Name)
 	}
-	return command.Handler(s, i)
+	return command.handler()(ctx, s, i)
 }
@@ -1,6 +1,7 @@
 package component
 
 import (
+	"context"
 	"strings"
 
 	"github.com/bwmarrin/discordgo"
@@ -8,11 +9,26 @@ import (
 
 type ComponentHandlerFunc func(i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error)
 
+// ContextHandlerFunc handles a component with the context of its interaction
+type ContextHandlerFunc func(ctx context.Context, i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error)
+
+// Adapt adapts a handler that does not take a context so that it can be used wherever a ContextHandlerFunc is expected
+func Adapt(handler ComponentHandlerFunc) ContextHandlerFunc {
+	return func(_ context.Context, i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error) {
+		return handler(i, data)
+	}
+}
+
 func CreateCustomId(prefix, interactionId, componentName string) string {
 	return strings.Join([]string{prefix, interactionId, componentName}, "-")
 }
 
+// ParseCustomId splits a custom ID created by CreateCustomId into its parts
+// The component name may contain dashes and missing parts are returned as empty strings
 func ParseCustomId(customId string) (prefix, interactionId, componentName string) {
-	split := strings.Split(customId, "-")
+	split := strings.SplitN(customId, "-", 3)
+	for len(split) < 3 {
+		split = append(split, "")
+	}
 	return split[0], split[1], split[2]
 }
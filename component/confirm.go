@@ -0,0 +1,152 @@
+package component
+
+import (
+	"context"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/utils"
+)
+
+const (
+	// DefaultConfirmTTL is how long a confirmation prompt waits for an answer when no TTL is provided
+	DefaultConfirmTTL = time.Minute
+)
+
+// ConfirmOutcome is the answer given to a confirmation prompt
+type ConfirmOutcome int
+
+const (
+	// ConfirmTimedOut means the prompt expired before the user answered
+	ConfirmTimedOut ConfirmOutcome = iota
+	// Confirmed means the user pressed the confirm button
+	Confirmed
+	// Cancelled means the user pressed the cancel button
+	Cancelled
+)
+
+func (o ConfirmOutcome) String() string {
+	switch o {
+	case Confirmed:
+		return "confirmed"
+	case Cancelled:
+		return "cancelled"
+	default:
+		return "timed out"
+	}
+}
+
+// ConfirmOptions describes a confirmation prompt
+type ConfirmOptions struct {
+	// Title is the title of the prompt, "Are you sure?" if empty
+	Title string
+	// Description describes the action that is being confirmed
+	Description string
+	// ConfirmLabel is the label of the confirm button, "Confirm" if empty
+	ConfirmLabel string
+	// CancelLabel is the label of the cancel button, "Cancel" if empty
+	CancelLabel string
+	// Destructive shows the confirm button in red
+	Destructive bool
+	// TTL is how long the prompt waits for an answer, DefaultConfirmTTL if zero
+	TTL time.Duration
+}
+
+// ConfirmFunc is called once a confirmation prompt has been answered or has timed out
+// i is the interaction of the button that was pressed, or nil if the prompt timed out
+// If a nil response is returned for an answer, the prompt is replaced with a short summary of the outcome
+type ConfirmFunc func(i *discordgo.InteractionCreate, outcome ConfirmOutcome) (*discordgo.InteractionResponse, error)
+
+// Confirm returns an ephemeral confirmation prompt and calls callback once it has been answered
+// Only the user of the interaction can answer the prompt. On timeout, the response of the callback is ignored
+func Confirm(store *SessionStore, i *discordgo.InteractionCreate, options ConfirmOptions, callback ConfirmFunc) *discordgo.InteractionResponse {
+	response, _ := confirm(store, i, options, callback)
+	return response
+}
+
+// AwaitConfirmation sends an ephemeral confirmation prompt and blocks until it has been answered, timed out or ctx is done
+// As the prompt is sent as the response to i, the calling handler must return a nil response
+// The returned interaction of the pressed button has already been acknowledged, so follow-up messages should be used
+func AwaitConfirmation(ctx context.Context, session *discordgo.Session, store *SessionStore, i *discordgo.InteractionCreate, options ConfirmOptions) (ConfirmOutcome, *discordgo.InteractionCreate, error) {
+	type answer struct {
+		outcome     ConfirmOutcome
+		interaction *discordgo.InteractionCreate
+	}
+	answers := make(chan answer, 1)
+	response, confirmSession := confirm(store, i, options, func(i *discordgo.InteractionCreate, outcome ConfirmOutcome) (*discordgo.InteractionResponse, error) {
+		select {
+		case answers <- answer{outcome: outcome, interaction: i}:
+		default:
+		}
+		return nil, nil
+	})
+	if err := session.InteractionRespond(i.Interaction, response); err != nil {
+		confirmSession.Close()
+		return ConfirmTimedOut, nil, err
+	}
+	select {
+	case answer := <-answers:
+		return answer.outcome, answer.interaction, nil
+	case <-ctx.Done():
+		confirmSession.Expire()
+		return ConfirmTimedOut, nil, ctx.Err()
+	}
+}
+
+func confirm(store *SessionStore, i *discordgo.InteractionCreate, options ConfirmOptions, callback ConfirmFunc) (*discordgo.InteractionResponse, *Session) {
+	if options.TTL <= 0 {
+		options.TTL = DefaultConfirmTTL
+	}
+	ownerId := ""
+	if user := utils.InteractionUser(i.Interaction); user != nil {
+		ownerId = user.ID
+	}
+	session := store.New(ownerId, options.TTL)
+	session.BindInteraction(i.Interaction)
+	session.OnExpire(func() {
+		callback(nil, ConfirmTimedOut)
+	})
+	answer := func(outcome ConfirmOutcome) ComponentHandlerFunc {
+		return func(i *discordgo.InteractionCreate, _ *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error) {
+			// the prompt has been answered, so it must not time out anymore
+			session.Close()
+			response, err := callback(i, outcome)
+			if err != nil || response != nil {
+				return response, err
+			}
+			embed := utils.IfElse(outcome == Confirmed, utils.SuccessAsEmbed("Confirmed."), utils.InfoAsEmbed("Cancelled."))
+			return &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseUpdateMessage,
+				Data: &discordgo.InteractionResponseData{
+					Embeds:     []*discordgo.MessageEmbed{embed},
+					Components: []discordgo.MessageComponent{},
+				},
+			}, nil
+		}
+	}
+	session.Handle("confirm", answer(Confirmed))
+	session.Handle("cancel", answer(Cancelled))
+
+	title := utils.IfElse(options.Title == "", "Are you sure?", options.Title)
+	confirmLabel := utils.IfElse(options.ConfirmLabel == "", "Confirm", options.ConfirmLabel)
+	cancelLabel := utils.IfElse(options.CancelLabel == "", "Cancel", options.CancelLabel)
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{{
+				Title:       title,
+				Description: options.Description,
+				Color:       utils.ColorWarning,
+			}},
+			Components: []discordgo.MessageComponent{Row(
+				&discordgo.Button{
+					CustomID: session.CustomID("confirm"),
+					Label:    confirmLabel,
+					Style:    utils.IfElse(options.Destructive, discordgo.DangerButton, discordgo.SuccessButton),
+				},
+				&discordgo.Button{CustomID: session.CustomID("cancel"), Label: cancelLabel, Style: discordgo.SecondaryButton},
+			)},
+		},
+	}, session
+}
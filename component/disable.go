@@ -0,0 +1,43 @@
+package component
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// DisableComponents returns a copy of the components where every button and select menu whose custom ID starts with
+// prefix is disabled. An empty prefix disables every component
+func DisableComponents(components []discordgo.MessageComponent, prefix string) []discordgo.MessageComponent {
+	disabled := make([]discordgo.MessageComponent, len(components))
+	for i, c := range components {
+		disabled[i] = disableComponent(c, prefix)
+	}
+	return disabled
+}
+
+func disableComponent(c discordgo.MessageComponent, prefix string) discordgo.MessageComponent {
+	switch c := c.(type) {
+	case *discordgo.ActionsRow:
+		return &discordgo.ActionsRow{Components: DisableComponents(c.Components, prefix)}
+	case discordgo.ActionsRow:
+		return &discordgo.ActionsRow{Components: DisableComponents(c.Components, prefix)}
+	case *discordgo.Button:
+		return disableComponent(*c, prefix)
+	case discordgo.Button:
+		// link buttons do not have a custom ID and never need to be disabled
+		if c.URL == "" && strings.HasPrefix(c.CustomID, prefix) {
+			c.Disabled = true
+		}
+		return &c
+	case *discordgo.SelectMenu:
+		return disableComponent(*c, prefix)
+	case discordgo.SelectMenu:
+		if strings.HasPrefix(c.CustomID, prefix) {
+			c.Disabled = true
+		}
+		return &c
+	default:
+		return c
+	}
+}
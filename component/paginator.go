@@ -0,0 +1,223 @@
+package component
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/modal"
+	"github.com/sylvrs/fuse/utils"
+)
+
+const (
+	// maxEmbedDescriptionLength is the maximum length of an embed description allowed by Discord
+	maxEmbedDescriptionLength = 4096
+	// DefaultItemsPerPage is the number of items shown per page by slice paginators when none is provided
+	DefaultItemsPerPage = 10
+)
+
+// PageFunc renders the page with the given zero-based index
+type PageFunc func(page int) (*discordgo.MessageEmbed, error)
+
+// ContextPageFunc renders the page with the given zero-based index with the context of the interaction showing it
+type ContextPageFunc func(ctx context.Context, page int) (*discordgo.MessageEmbed, error)
+
+// Paginator displays a list of embeds one page at a time with buttons to navigate between them
+// Only the user who opened the paginator can use its controls, which are disabled once it times out
+type Paginator struct {
+	// Pages is the total number of pages
+	Pages int
+	// Render renders a single page, it is only called for the pages that are actually shown
+	Render PageFunc
+	// RenderContext is used instead of Render if set
+	RenderContext ContextPageFunc
+	// TTL is how long the paginator stays usable after its last use, DefaultSessionTTL is used if zero
+	TTL time.Duration
+	// Ephemeral makes the paginator only visible to the user who opened it
+	Ephemeral bool
+}
+
+// paginatorRun is a single sent paginator message
+// A Paginator only describes the pages, so the same one may be sent any number of times
+type paginatorRun struct {
+	*Paginator
+	session *Session
+	mutex   sync.Mutex
+	current int
+}
+
+// NewPaginator creates a paginator that lazily renders each page
+func NewPaginator(pages int, render PageFunc) *Paginator {
+	return &Paginator{Pages: pages, Render: render}
+}
+
+// NewSlicePaginator creates a paginator that lists the items as lines of the embed description
+// Pages hold up to perPage items and are split early if they would not fit in a single embed
+func NewSlicePaginator(title string, items []string, perPage int) *Paginator {
+	if perPage <= 0 {
+		perPage = DefaultItemsPerPage
+	}
+	pages := make([]string, 0)
+	var builder strings.Builder
+	count := 0
+	for _, item := range items {
+		line := truncateLine(fmt.Sprintf("- %s\n", item))
+		if count == perPage || builder.Len()+len(line) > maxEmbedDescriptionLength {
+			pages = append(pages, builder.String())
+			builder.Reset()
+			count = 0
+		}
+		builder.WriteString(line)
+		count++
+	}
+	if count != 0 {
+		pages = append(pages, builder.String())
+	}
+	return NewPaginator(len(pages), func(page int) (*discordgo.MessageEmbed, error) {
+		return &discordgo.MessageEmbed{
+			Title:       title,
+			Description: pages[page],
+			Color:       utils.ColorPrimary,
+		}, nil
+	})
+}
+
+// truncateLine shortens a line so that it fits in an embed description without splitting a UTF-8 character
+func truncateLine(line string) string {
+	if len(line) <= maxEmbedDescriptionLength {
+		return line
+	}
+	end := maxEmbedDescriptionLength - len("...\n")
+	for end > 0 && !utf8.RuneStart(line[end]) {
+		end--
+	}
+	return line[:end] + "...\n"
+}
+
+// Send creates the session for the paginator's controls and returns the response showing the first page
+func (p *Paginator) Send(store *SessionStore, modals *modal.ModalHandler, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	return p.SendContext(context.Background(), store, modals, i)
+}
+
+// SendContext is like Send but renders the first page with the context of the interaction being handled
+func (p *Paginator) SendContext(ctx context.Context, store *SessionStore, modals *modal.ModalHandler, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	if p.Pages <= 0 {
+		return &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Flags:  utils.IfElse(p.Ephemeral, discordgo.MessageFlagsEphemeral, 0),
+				Embeds: []*discordgo.MessageEmbed{utils.InfoAsEmbed("There is nothing to show.")},
+			},
+		}, nil
+	}
+	ownerId := ""
+	if user := utils.InteractionUser(i.Interaction); user != nil {
+		ownerId = user.ID
+	}
+	r := &paginatorRun{Paginator: p, session: store.New(ownerId, p.TTL)}
+	r.session.BindInteraction(i.Interaction)
+	r.session.HandleContext("first", r.navigate(func(int) int { return 0 }))
+	r.session.HandleContext("previous", r.navigate(func(current int) int { return current - 1 }))
+	r.session.HandleContext("next", r.navigate(func(current int) int { return current + 1 }))
+	r.session.HandleContext("last", r.navigate(func(int) int { return r.Pages - 1 }))
+	r.session.Handle("jump", func(i *discordgo.InteractionCreate, _ *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error) {
+		return modals.Send(i, r.jumpModal())
+	})
+
+	data, err := r.render(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	data.Flags = utils.IfElse(p.Ephemeral, discordgo.MessageFlagsEphemeral, 0)
+	return &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: data}, nil
+}
+
+// navigate creates a handler that moves to the page returned by target
+func (r *paginatorRun) navigate(target func(current int) int) ContextHandlerFunc {
+	return func(ctx context.Context, _ *discordgo.InteractionCreate, _ *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error) {
+		r.mutex.Lock()
+		page := target(r.current)
+		r.mutex.Unlock()
+		return r.update(ctx, page)
+	}
+}
+
+// jumpModal creates the modal asking for the page to jump to
+func (r *paginatorRun) jumpModal() *modal.Modal {
+	r.mutex.Lock()
+	current := r.current
+	r.mutex.Unlock()
+	jump := modal.NewTextModal(r.session.CustomID("jump-modal"), "Jump to page", []discordgo.TextInput{{
+		CustomID:    "page",
+		Label:       fmt.Sprintf("Page (1-%d)", r.Pages),
+		Style:       discordgo.TextInputShort,
+		Placeholder: strconv.Itoa(current + 1),
+		Required:    true,
+		MaxLength:   len(strconv.Itoa(r.Pages)),
+	}}, nil)
+	jump.ContextHandler = func(ctx context.Context, _ *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+		value := ""
+		for _, row := range i.ModalSubmitData().Components {
+			if row, ok := row.(*discordgo.ActionsRow); ok && len(row.Components) != 0 {
+				if input, ok := row.Components[0].(*discordgo.TextInput); ok {
+					value = input.Value
+				}
+			}
+		}
+		page, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || page < 1 || page > r.Pages {
+			return nil, fmt.Errorf("the page must be a number between 1 and %d", r.Pages)
+		}
+		return r.update(ctx, page-1)
+	}
+	return jump
+}
+
+// update moves to the page and returns the response updating the message
+func (r *paginatorRun) update(ctx context.Context, page int) (*discordgo.InteractionResponse, error) {
+	data, err := r.render(ctx, page)
+	if err != nil {
+		return nil, err
+	}
+	r.session.Extend()
+	return &discordgo.InteractionResponse{Type: discordgo.InteractionResponseUpdateMessage, Data: data}, nil
+}
+
+// render renders the page along with the navigation controls
+func (r *paginatorRun) render(ctx context.Context, page int) (*discordgo.InteractionResponseData, error) {
+	if page < 0 || page >= r.Pages {
+		return nil, errors.New("page out of range")
+	}
+	var embed *discordgo.MessageEmbed
+	var err error
+	if r.RenderContext != nil {
+		embed, err = r.RenderContext(ctx, page)
+	} else {
+		embed, err = r.Render(page)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.mutex.Lock()
+	r.current = page
+	r.mutex.Unlock()
+
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Page %d of %d", page+1, r.Pages)}
+	first, last := page == 0, page == r.Pages-1
+	return &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Components: []discordgo.MessageComponent{Row(
+			&discordgo.Button{CustomID: r.session.CustomID("first"), Label: "«", Style: discordgo.SecondaryButton, Disabled: first},
+			&discordgo.Button{CustomID: r.session.CustomID("previous"), Label: "‹", Style: discordgo.PrimaryButton, Disabled: first},
+			&discordgo.Button{CustomID: r.session.CustomID("jump"), Label: fmt.Sprintf("%d/%d", page+1, r.Pages), Style: discordgo.SecondaryButton, Disabled: r.Pages == 1},
+			&discordgo.Button{CustomID: r.session.CustomID("next"), Label: "›", Style: discordgo.PrimaryButton, Disabled: last},
+			&discordgo.Button{CustomID: r.session.CustomID("last"), Label: "»", Style: discordgo.SecondaryButton, Disabled: last},
+		)},
+	}, nil
+}
@@ -0,0 +1,260 @@
+package component
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// MaxCustomIdLength is the maximum length of a custom ID allowed by Discord
+	MaxCustomIdLength = 100
+	// routeSeparator separates the segments of a route pattern, e.g. `ticket:close:{id}`
+	routeSeparator = ":"
+)
+
+// ErrCustomIdTooLong is returned when an encoded custom ID exceeds MaxCustomIdLength
+var ErrCustomIdTooLong = errors.New("custom id exceeds 100 characters")
+
+// RouteHandlerFunc handles a component whose custom ID matched a route
+type RouteHandlerFunc func(i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData, params Params) (*discordgo.InteractionResponse, error)
+
+// RouteContextHandlerFunc handles a component whose custom ID matched a route with the context of its interaction
+type RouteContextHandlerFunc func(ctx context.Context, i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData, params Params) (*discordgo.InteractionResponse, error)
+
+// AdaptRoute adapts a route handler that does not take a context so that it can be used wherever a RouteContextHandlerFunc is expected
+func AdaptRoute(handler RouteHandlerFunc) RouteContextHandlerFunc {
+	return func(_ context.Context, i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData, params Params) (*discordgo.InteractionResponse, error) {
+		return handler(i, data, params)
+	}
+}
+
+// Params holds the parameters extracted from a custom ID
+type Params map[string]string
+
+// Get returns the value of the parameter or an empty string if it does not exist
+func (p Params) Get(name string) string {
+	return p[name]
+}
+
+// Int returns the value of the parameter as an integer
+func (p Params) Int(name string) (int64, error) {
+	value, ok := p[name]
+	if !ok {
+		return 0, fmt.Errorf("parameter '%s' not found", name)
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// segment is a single part of a route pattern, either a literal or a parameter
+type segment struct {
+	value string
+	param bool
+}
+
+// Route is a custom ID pattern such as `ticket:close:{id}`
+// Literal segments must match exactly while parameter segments match any value
+type Route struct {
+	pattern  string
+	segments []segment
+}
+
+// NewRoute parses a route pattern
+func NewRoute(pattern string) (*Route, error) {
+	route := &Route{pattern: pattern}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(pattern, routeSeparator) {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			name := part[1 : len(part)-1]
+			if name == "" {
+				return nil, fmt.Errorf("route '%s' has an unnamed parameter", pattern)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("route '%s' has a duplicate parameter '%s'", pattern, name)
+			}
+			seen[name] = true
+			route.segments = append(route.segments, segment{value: name, param: true})
+			continue
+		}
+		if part == "" || strings.ContainsAny(part, "{}%") {
+			return nil, fmt.Errorf("route '%s' has an invalid segment '%s'", pattern, part)
+		}
+		route.segments = append(route.segments, segment{value: part})
+	}
+	return route, nil
+}
+
+// MustRoute parses a route pattern and panics if it is invalid
+func MustRoute(pattern string) *Route {
+	route, err := NewRoute(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return route
+}
+
+// Pattern returns the pattern the route was created from
+func (r *Route) Pattern() string {
+	return r.pattern
+}
+
+// Match returns the parameters of the custom ID if it matches the route
+func (r *Route) Match(customId string) (Params, bool) {
+	parts := strings.Split(customId, routeSeparator)
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+	params := make(Params)
+	for i, segment := range r.segments {
+		if !segment.param {
+			if parts[i] != segment.value {
+				return nil, false
+			}
+			continue
+		}
+		value, err := UnescapeParam(parts[i])
+		if err != nil {
+			return nil, false
+		}
+		params[segment.value] = value
+	}
+	return params, true
+}
+
+// Encode creates a custom ID from the route by filling in the parameters
+// Values may contain any character, but the resulting custom ID must fit in MaxCustomIdLength
+func (r *Route) Encode(params Params) (string, error) {
+	parts := make([]string, len(r.segments))
+	for i, segment := range r.segments {
+		if !segment.param {
+			parts[i] = segment.value
+			continue
+		}
+		value, ok := params[segment.value]
+		if !ok {
+			return "", fmt.Errorf("missing parameter '%s' for route '%s'", segment.value, r.pattern)
+		}
+		parts[i] = EscapeParam(value)
+	}
+	customId := strings.Join(parts, routeSeparator)
+	if len(customId) > MaxCustomIdLength {
+		return "", ErrCustomIdTooLong
+	}
+	return customId, nil
+}
+
+// EscapeParam escapes the characters of a parameter value that would otherwise break parsing of a custom ID
+func EscapeParam(value string) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '%', ':':
+			builder.WriteString(fmt.Sprintf("%%%02X", c))
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
+}
+
+// UnescapeParam reverses EscapeParam
+func UnescapeParam(value string) (string, error) {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' {
+			builder.WriteByte(value[i])
+			continue
+		}
+		if i+2 >= len(value) {
+			return "", fmt.Errorf("invalid escape sequence in '%s'", value)
+		}
+		c, err := strconv.ParseUint(value[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid escape sequence in '%s'", value)
+		}
+		builder.WriteByte(byte(c))
+		i += 2
+	}
+	return builder.String(), nil
+}
+
+// routeEntry is a route registered to a router along with its handler
+type routeEntry struct {
+	route   *Route
+	handler RouteContextHandlerFunc
+}
+
+// Router dispatches components to handlers based on route patterns
+// Routes are matched in the order they were registered
+type Router struct {
+	mutex  sync.RWMutex
+	routes []routeEntry
+}
+
+func NewRouter() *Router {
+	return &Router{routes: make([]routeEntry, 0)}
+}
+
+// Handle registers a handler for every custom ID matching the pattern
+func (r *Router) Handle(pattern string, handler RouteHandlerFunc) error {
+	return r.HandleContext(pattern, AdaptRoute(handler))
+}
+
+// HandleContext registers a handler that receives the context of the interaction for every custom ID matching the pattern
+func (r *Router) HandleContext(pattern string, handler RouteContextHandlerFunc) error {
+	route, err := NewRoute(pattern)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.routes = append(r.routes, routeEntry{route: route, handler: handler})
+	return nil
+}
+
+// Remove removes the handler registered for the pattern
+func (r *Router) Remove(pattern string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, entry := range r.routes {
+		if entry.route.pattern == pattern {
+			r.routes = append(r.routes[:i], r.routes[i+1:]...)
+			return
+		}
+	}
+}
+
+// Match returns the handler and parameters of the first route matching the custom ID
+func (r *Router) Match(customId string) (RouteHandlerFunc, Params, bool) {
+	_, handler, params, ok := r.Lookup(customId)
+	return handler, params, ok
+}
+
+// Lookup is like Match but also returns the route that matched
+// The returned handler runs without the context of an interaction, LookupContext should be used when one is available
+func (r *Router) Lookup(customId string) (*Route, RouteHandlerFunc, Params, bool) {
+	route, handler, params, ok := r.LookupContext(customId)
+	if !ok {
+		return nil, nil, nil, false
+	}
+	return route, func(i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData, params Params) (*discordgo.InteractionResponse, error) {
+		return handler(context.Background(), i, data, params)
+	}, params, true
+}
+
+// LookupContext is like Lookup but returns the handler taking the context of the interaction
+func (r *Router) LookupContext(customId string) (*Route, RouteContextHandlerFunc, Params, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, entry := range r.routes {
+		if params, ok := entry.route.Match(customId); ok {
+			return entry.route, entry.handler, params, true
+		}
+	}
+	return nil, nil, nil, false
+}
@@ -0,0 +1,129 @@
+package component
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEscapeParam(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"123", "123"},
+		{"a:b", "a%3Ab"},
+		{"100%", "100%25"},
+		{"%3A", "%253A"},
+		{"::", "%3A%3A"},
+		{"héllo wörld", "héllo wörld"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		escaped := EscapeParam(test.value)
+		if escaped != test.expected {
+			t.Errorf("EscapeParam(%q) = %q, expected %q", test.value, escaped, test.expected)
+		}
+		unescaped, err := UnescapeParam(escaped)
+		if err != nil {
+			t.Errorf("UnescapeParam(%q) failed: %v", escaped, err)
+		} else if unescaped != test.value {
+			t.Errorf("UnescapeParam(%q) = %q, expected %q", escaped, unescaped, test.value)
+		}
+	}
+}
+
+func TestUnescapeParamInvalid(t *testing.T) {
+	for _, value := range []string{"%", "%3", "abc%", "%ZZ", "%G1"} {
+		if _, err := UnescapeParam(value); err == nil {
+			t.Errorf("expected UnescapeParam(%q) to fail", value)
+		}
+	}
+}
+
+func TestNewRouteInvalid(t *testing.T) {
+	for _, pattern := range []string{"", "ticket::close", "ticket:{}", "ticket:{id}:{id}", "ticket:cl{ose", "ticket:100%"} {
+		if _, err := NewRoute(pattern); err == nil {
+			t.Errorf("expected NewRoute(%q) to fail", pattern)
+		}
+	}
+}
+
+func TestRouteEncodeAndMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		params   Params
+		customId string
+	}{
+		{"ticket:close", Params{}, "ticket:close"},
+		{"ticket:close:{id}", Params{"id": "42"}, "ticket:close:42"},
+		{"ticket:{action}:{id}", Params{"action": "open", "id": "7"}, "ticket:open:7"},
+		{"note:{text}", Params{"text": "a:b:c"}, "note:a%3Ab%3Ac"},
+		{"note:{text}", Params{"text": "50% off"}, "note:50%25 off"},
+		{"note:{text}", Params{"text": ""}, "note:"},
+	}
+	for _, test := range tests {
+		route := MustRoute(test.pattern)
+		customId, err := route.Encode(test.params)
+		if err != nil {
+			t.Errorf("%s: failed to encode %v: %v", test.pattern, test.params, err)
+			continue
+		}
+		if customId != test.customId {
+			t.Errorf("%s: encoded %v as %q, expected %q", test.pattern, test.params, customId, test.customId)
+		}
+		params, ok := route.Match(customId)
+		if !ok {
+			t.Errorf("%s: expected %q to match", test.pattern, customId)
+			continue
+		}
+		for name, value := range test.params {
+			if params.Get(name) != value {
+				t.Errorf("%s: matched %s = %q, expected %q", test.pattern, name, params.Get(name), value)
+			}
+		}
+	}
+}
+
+func TestRouteMatchMismatch(t *testing.T) {
+	route := MustRoute("ticket:close:{id}")
+	for _, customId := range []string{"ticket:close", "ticket:open:1", "ticket:close:1:2", "ticket:close:%Z1", "other"} {
+		if _, ok := route.Match(customId); ok {
+			t.Errorf("expected %q not to match %s", customId, route.Pattern())
+		}
+	}
+}
+
+func TestRouteEncodeMissingParam(t *testing.T) {
+	if _, err := MustRoute("ticket:{action}:{id}").Encode(Params{"action": "close"}); err == nil {
+		t.Error("expected encoding without every parameter to fail")
+	}
+}
+
+func TestRouteEncodeLength(t *testing.T) {
+	route := MustRoute("p:{value}")
+	tests := []struct {
+		value string
+		err   error
+	}{
+		// the prefix `p:` takes 2 of the 100 characters
+		{strings.Repeat("a", MaxCustomIdLength-2), nil},
+		{strings.Repeat("a", MaxCustomIdLength-1), ErrCustomIdTooLong},
+		// escaping counts towards the limit, each `:` takes 3 characters
+		{strings.Repeat(":", 32), nil},
+		{strings.Repeat(":", 33), ErrCustomIdTooLong},
+		// the limit is in bytes, so multi-byte characters count more than once
+		{strings.Repeat("é", 49), nil},
+		{strings.Repeat("é", 50), ErrCustomIdTooLong},
+	}
+	for _, test := range tests {
+		customId, err := route.Encode(Params{"value": test.value})
+		if !errors.Is(err, test.err) {
+			t.Errorf("encoding a %d byte value returned %v, expected %v", len(test.value), err, test.err)
+			continue
+		}
+		if err == nil && len(customId) > MaxCustomIdLength {
+			t.Errorf("encoded custom id is %d characters long", len(customId))
+		}
+	}
+}
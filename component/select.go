@@ -0,0 +1,164 @@
+package component
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// StringSelectHandlerFunc handles a string select menu with the selected values
+type StringSelectHandlerFunc func(i *discordgo.InteractionCreate, values []string) (*discordgo.InteractionResponse, error)
+
+// UserSelectHandlerFunc handles a user select menu with the selected members
+// In DMs, the members only carry their user
+type UserSelectHandlerFunc func(i *discordgo.InteractionCreate, members []*discordgo.Member) (*discordgo.InteractionResponse, error)
+
+// RoleSelectHandlerFunc handles a role select menu with the selected roles
+type RoleSelectHandlerFunc func(i *discordgo.InteractionCreate, roles []*discordgo.Role) (*discordgo.InteractionResponse, error)
+
+// ChannelSelectHandlerFunc handles a channel select menu with the selected channels
+type ChannelSelectHandlerFunc func(i *discordgo.InteractionCreate, channels []*discordgo.Channel) (*discordgo.InteractionResponse, error)
+
+// MentionableSelectHandlerFunc handles a mentionable select menu with the selected members and roles
+type MentionableSelectHandlerFunc func(i *discordgo.InteractionCreate, members []*discordgo.Member, roles []*discordgo.Role) (*discordgo.InteractionResponse, error)
+
+// StringSelect creates a select menu with the given options
+func StringSelect(customId, placeholder string, options ...discordgo.SelectMenuOption) *discordgo.SelectMenu {
+	return &discordgo.SelectMenu{
+		MenuType:    discordgo.StringSelectMenu,
+		CustomID:    customId,
+		Placeholder: placeholder,
+		Options:     options,
+	}
+}
+
+// UserSelect creates a select menu that is populated with the members of the guild
+func UserSelect(customId, placeholder string) *discordgo.SelectMenu {
+	return &discordgo.SelectMenu{MenuType: discordgo.UserSelectMenu, CustomID: customId, Placeholder: placeholder}
+}
+
+// RoleSelect creates a select menu that is populated with the roles of the guild
+func RoleSelect(customId, placeholder string) *discordgo.SelectMenu {
+	return &discordgo.SelectMenu{MenuType: discordgo.RoleSelectMenu, CustomID: customId, Placeholder: placeholder}
+}
+
+// ChannelSelect creates a select menu that is populated with the channels of the guild
+// If channel types are given, only channels of those types are shown
+func ChannelSelect(customId, placeholder string, channelTypes ...discordgo.ChannelType) *discordgo.SelectMenu {
+	return &discordgo.SelectMenu{
+		MenuType:     discordgo.ChannelSelectMenu,
+		CustomID:     customId,
+		Placeholder:  placeholder,
+		ChannelTypes: channelTypes,
+	}
+}
+
+// MentionableSelect creates a select menu that is populated with both the members and roles of the guild
+func MentionableSelect(customId, placeholder string) *discordgo.SelectMenu {
+	return &discordgo.SelectMenu{MenuType: discordgo.MentionableSelectMenu, CustomID: customId, Placeholder: placeholder}
+}
+
+// Row wraps the components in an actions row
+func Row(components ...discordgo.MessageComponent) discordgo.ActionsRow {
+	return discordgo.ActionsRow{Components: components}
+}
+
+// OnStringSelect adapts a string select handler so that it can be used wherever a ComponentHandlerFunc is expected
+// e.g. mng.ListenForComponent("color", component.OnStringSelect(handler))
+func OnStringSelect(handler StringSelectHandlerFunc) ComponentHandlerFunc {
+	return func(i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error) {
+		return handler(i, data.Values)
+	}
+}
+
+// OnUserSelect adapts a user select handler so that it receives the resolved members
+func OnUserSelect(handler UserSelectHandlerFunc) ComponentHandlerFunc {
+	return func(i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error) {
+		members, err := resolveMembers(i, data, data.Values)
+		if err != nil {
+			return nil, err
+		}
+		return handler(i, members)
+	}
+}
+
+// OnRoleSelect adapts a role select handler so that it receives the resolved roles
+func OnRoleSelect(handler RoleSelectHandlerFunc) ComponentHandlerFunc {
+	return func(i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error) {
+		roles, err := resolveRoles(data, data.Values)
+		if err != nil {
+			return nil, err
+		}
+		return handler(i, roles)
+	}
+}
+
+// OnChannelSelect adapts a channel select handler so that it receives the resolved channels
+func OnChannelSelect(handler ChannelSelectHandlerFunc) ComponentHandlerFunc {
+	return func(i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error) {
+		channels := make([]*discordgo.Channel, len(data.Values))
+		for index, id := range data.Values {
+			channel, ok := data.Resolved.Channels[id]
+			if !ok {
+				return nil, fmt.Errorf("channel %s was not resolved", id)
+			}
+			channels[index] = channel
+		}
+		return handler(i, channels)
+	}
+}
+
+// OnMentionableSelect adapts a mentionable select handler so that it receives the resolved members and roles
+func OnMentionableSelect(handler MentionableSelectHandlerFunc) ComponentHandlerFunc {
+	return func(i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error) {
+		userIds, roleIds := make([]string, 0), make([]string, 0)
+		for _, id := range data.Values {
+			if _, ok := data.Resolved.Roles[id]; ok {
+				roleIds = append(roleIds, id)
+				continue
+			}
+			userIds = append(userIds, id)
+		}
+		members, err := resolveMembers(i, data, userIds)
+		if err != nil {
+			return nil, err
+		}
+		roles, err := resolveRoles(data, roleIds)
+		if err != nil {
+			return nil, err
+		}
+		return handler(i, members, roles)
+	}
+}
+
+// resolveMembers looks up the selected members, filling in their users as Discord omits them from resolved members
+func resolveMembers(i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData, ids []string) ([]*discordgo.Member, error) {
+	members := make([]*discordgo.Member, len(ids))
+	for index, id := range ids {
+		user, ok := data.Resolved.Users[id]
+		if !ok {
+			return nil, fmt.Errorf("user %s was not resolved", id)
+		}
+		member, ok := data.Resolved.Members[id]
+		if !ok {
+			// users outside of guilds (e.g. in DMs) have no member
+			member = &discordgo.Member{}
+		}
+		member.User = user
+		member.GuildID = i.GuildID
+		members[index] = member
+	}
+	return members, nil
+}
+
+func resolveRoles(data *discordgo.MessageComponentInteractionData, ids []string) ([]*discordgo.Role, error) {
+	roles := make([]*discordgo.Role, len(ids))
+	for index, id := range ids {
+		role, ok := data.Resolved.Roles[id]
+		if !ok {
+			return nil, fmt.Errorf("role %s was not resolved", id)
+		}
+		roles[index] = role
+	}
+	return roles, nil
+}
@@ -0,0 +1,287 @@
+package component
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/utils"
+)
+
+const (
+	// DefaultSessionTTL is the lifetime of a session when no TTL is provided
+	DefaultSessionTTL = 5 * time.Minute
+	// SessionRoute is the route used by the custom IDs of session components
+	SessionRoute = "fuse:session:{session}:{name}"
+	// sessionSweepInterval is how often the store checks for expired sessions
+	sessionSweepInterval = 5 * time.Second
+)
+
+var sessionRoute = MustRoute(SessionRoute)
+
+// Session is a set of component handlers tied to a single message and optionally a single user
+// Once the session expires, its handlers are removed and its components are disabled
+type Session struct {
+	store       *SessionStore
+	id          string
+	ownerId     string
+	ttl         time.Duration
+	mutex       sync.Mutex
+	expiresAt   time.Time
+	handlers    map[string]ContextHandlerFunc
+	onExpire    func()
+	channelId   string
+	messageId   string
+	interaction *discordgo.Interaction
+}
+
+// ID returns the unique ID of the session
+func (s *Session) ID() string {
+	return s.id
+}
+
+// OwnerID returns the ID of the user allowed to use the session's components, or an empty string if anyone may
+func (s *Session) OwnerID() string {
+	return s.ownerId
+}
+
+// CustomID returns the custom ID to use for the session component with the given name
+// It panics if the resulting custom ID would be too long for Discord
+func (s *Session) CustomID(name string) string {
+	customId, err := sessionRoute.Encode(Params{"session": s.id, "name": name})
+	if err != nil {
+		panic(fmt.Errorf("invalid session component name '%s': %w", name, err))
+	}
+	return customId
+}
+
+// Handle registers the handler for the session component with the given name
+func (s *Session) Handle(name string, handler ComponentHandlerFunc) *Session {
+	return s.HandleContext(name, Adapt(handler))
+}
+
+// HandleContext registers a handler that receives the context of its interaction for the session component with the given name
+func (s *Session) HandleContext(name string, handler ContextHandlerFunc) *Session {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.handlers[name] = handler
+	return s
+}
+
+// BindMessage ties the session to a sent message so that its components can be disabled when it expires
+func (s *Session) BindMessage(channelId, messageId string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.channelId, s.messageId = channelId, messageId
+}
+
+// BindInteraction ties the session to the response of an interaction
+// This must be used for ephemeral responses as they cannot be edited through the channel
+func (s *Session) BindInteraction(interaction *discordgo.Interaction) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.interaction = interaction
+}
+
+// OnExpire registers a function that is called once the session has expired
+func (s *Session) OnExpire(f func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onExpire = f
+}
+
+// Extend resets the lifetime of the session
+func (s *Session) Extend() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expiresAt = time.Now().Add(s.ttl)
+}
+
+// Expire ends the session immediately, disabling its components
+func (s *Session) Expire() {
+	if s.store.remove(s.id) {
+		go s.expire()
+	}
+}
+
+// Close ends the session immediately without touching its message
+// This is useful when the message was deleted or replaced by the handler
+func (s *Session) Close() {
+	s.store.remove(s.id)
+}
+
+func (s *Session) expired(now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return now.After(s.expiresAt)
+}
+
+// expire disables the components of the bound message and runs the expiry callback
+func (s *Session) expire() {
+	s.mutex.Lock()
+	channelId, messageId, interaction, onExpire := s.channelId, s.messageId, s.interaction, s.onExpire
+	s.mutex.Unlock()
+
+	// every component of the session shares the custom ID of an empty name as prefix
+	prefix := s.CustomID("")
+	session := s.store.session
+	if interaction != nil {
+		if message, err := session.InteractionResponse(interaction); err == nil {
+			components := DisableComponents(message.Components, prefix)
+			session.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{Components: &components})
+		}
+	} else if messageId != "" {
+		if message, err := session.ChannelMessage(channelId, messageId); err == nil {
+			components := DisableComponents(message.Components, prefix)
+			session.ChannelMessageEditComplex(&discordgo.MessageEdit{ID: messageId, Channel: channelId, Components: &components})
+		}
+	}
+	if onExpire != nil {
+		onExpire()
+	}
+}
+
+// SessionStore holds the component sessions of a guild and expires them once their lifetime has passed
+type SessionStore struct {
+	session  *discordgo.Session
+	mutex    sync.Mutex
+	sessions map[string]*Session
+	stop     chan struct{}
+}
+
+func NewSessionStore(session *discordgo.Session) *SessionStore {
+	return &SessionStore{
+		session:  session,
+		sessions: make(map[string]*Session),
+	}
+}
+
+// New creates a session whose components can only be used by the owner for the given lifetime
+// If ownerId is empty, anyone may use the components. If ttl is zero, DefaultSessionTTL is used
+func (s *SessionStore) New(ownerId string, ttl time.Duration) *Session {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	session := &Session{
+		store:     s,
+		id:        utils.RandomId(8),
+		ownerId:   ownerId,
+		ttl:       ttl,
+		expiresAt: time.Now().Add(ttl),
+		handlers:  make(map[string]ContextHandlerFunc),
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sessions[session.id] = session
+	return session
+}
+
+// Get returns the session with the given ID
+func (s *SessionStore) Get(id string) (*Session, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	session, ok := s.sessions[id]
+	return session, ok
+}
+
+// remove removes the session from the store and returns true if it was still active
+func (s *SessionStore) remove(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.sessions[id]
+	delete(s.sessions, id)
+	return ok
+}
+
+// HandleComponent dispatches a component matching SessionRoute to its session
+// It can be registered directly to a router with HandleContext
+func (s *SessionStore) HandleComponent(ctx context.Context, i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData, params Params) (*discordgo.InteractionResponse, error) {
+	session, ok := s.Get(params.Get("session"))
+	if !ok {
+		return utils.EphemeralResponse(utils.InfoAsEmbed("This interaction has expired.")), nil
+	}
+	session.mutex.Lock()
+	// bind the session to the message the first time one of its components is used
+	if session.messageId == "" && session.interaction == nil && i.Message != nil && i.Message.Flags&discordgo.MessageFlagsEphemeral == 0 {
+		session.channelId, session.messageId = i.Message.ChannelID, i.Message.ID
+	}
+	session.mutex.Unlock()
+	// the session may have expired since the last sweep
+	if session.expired(time.Now()) {
+		session.Expire()
+		return utils.EphemeralResponse(utils.InfoAsEmbed("This interaction has expired.")), nil
+	}
+	if user := utils.InteractionUser(i.Interaction); session.ownerId != "" && (user == nil || user.ID != session.ownerId) {
+		return utils.EphemeralResponse(utils.ErrorAsEmbed("Only the user who started this interaction can use it.")), nil
+	}
+	session.mutex.Lock()
+	handler, ok := session.handlers[params.Get("name")]
+	session.mutex.Unlock()
+	if !ok {
+		return nil, errors.New("no handler registered for this component")
+	}
+	return handler(ctx, i, data)
+}
+
+// Start starts expiring sessions in the background
+func (s *SessionStore) Start() {
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(sessionSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				s.sweep(now)
+			case <-stop:
+				return
+			}
+		}
+	}(s.stop)
+}
+
+// Stop stops expiring sessions in the background and expires the remaining sessions, disabling their components
+func (s *SessionStore) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.mutex.Lock()
+	remaining := make([]*Session, 0, len(s.sessions))
+	for id, session := range s.sessions {
+		remaining = append(remaining, session)
+		delete(s.sessions, id)
+	}
+	s.mutex.Unlock()
+	var wg sync.WaitGroup
+	for _, session := range remaining {
+		wg.Add(1)
+		go func(session *Session) {
+			defer wg.Done()
+			session.expire()
+		}(session)
+	}
+	wg.Wait()
+}
+
+// sweep removes and expires every session whose lifetime has passed
+func (s *SessionStore) sweep(now time.Time) {
+	expired := make([]*Session, 0)
+	s.mutex.Lock()
+	for id, session := range s.sessions {
+		if session.expired(now) {
+			expired = append(expired, session)
+			delete(s.sessions, id)
+		}
+	}
+	s.mutex.Unlock()
+	for _, session := range expired {
+		session.expire()
+	}
+}
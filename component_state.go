@@ -0,0 +1,179 @@
+package fuse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/component"
+	"github.com/sylvrs/fuse/utils"
+)
+
+const (
+	// PersistentRoute is the route used by the custom IDs of persistent components
+	PersistentRoute = "fuse:p:{route}:{state}:{action}"
+)
+
+var persistentRoute = component.MustRoute(PersistentRoute)
+
+// ComponentState is the database representation of the state of a persistent component
+// A single state may be shared by multiple components on the same message
+type ComponentState struct {
+	// ID is the random ID used in the custom IDs of the components
+	ID string `gorm:"primaryKey"`
+	// GuildID is the ID of the guild the component was created in
+	GuildID string `gorm:"index"`
+	// Route is the stable name of the handler for the components
+	Route string
+	// MessageID is the ID of the message the components are attached to, once known
+	MessageID string `gorm:"index"`
+	// Data is the JSON-encoded state
+	Data      string `gorm:"type:TEXT"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// PersistentHandlerFunc handles a persistent component along with its restored state
+type PersistentHandlerFunc func(i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData, state *PersistentState) (*discordgo.InteractionResponse, error)
+
+// PersistentContextHandlerFunc handles a persistent component along with its restored state and the context of its interaction
+type PersistentContextHandlerFunc func(ctx context.Context, i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData, state *PersistentState) (*discordgo.InteractionResponse, error)
+
+// PersistentState gives access to the stored state of a persistent component
+type PersistentState struct {
+	mng    *GuildManager
+	record *ComponentState
+	action string
+}
+
+// ID returns the ID of the state
+func (s *PersistentState) ID() string {
+	return s.record.ID
+}
+
+// Route returns the name of the handler the state belongs to
+func (s *PersistentState) Route() string {
+	return s.record.Route
+}
+
+// MessageID returns the ID of the message the state is attached to, if known
+func (s *PersistentState) MessageID() string {
+	return s.record.MessageID
+}
+
+// Action returns the action of the component that was used, as passed to CustomID
+func (s *PersistentState) Action() string {
+	return s.action
+}
+
+// CustomID returns the custom ID of a component backed by this state
+// The action is used to tell apart multiple components sharing the same state
+func (s *PersistentState) CustomID(action string) (string, error) {
+	return persistentRoute.Encode(component.Params{"route": s.record.Route, "state": s.record.ID, "action": action})
+}
+
+// Decode decodes the stored state into v
+func (s *PersistentState) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(s.record.Data), v)
+}
+
+// Save replaces the stored state with v
+func (s *PersistentState) Save(v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.record.Data = string(raw)
+	return s.mng.Connection().Save(s.record).Error
+}
+
+// BindMessage attaches the state to a message so that it is deleted along with it
+// States are attached automatically the first time one of their components is used
+func (s *PersistentState) BindMessage(messageId string) error {
+	s.record.MessageID = messageId
+	return s.mng.Connection().Model(s.record).Update("message_id", messageId).Error
+}
+
+// Delete removes the state, after which its components stop working
+func (s *PersistentState) Delete() error {
+	return s.mng.Connection().Delete(s.record).Error
+}
+
+// HandlePersistent registers the handler for persistent components created with the given route name
+// As the handler is looked up by name, it must be registered again every time the service starts
+func (mng *GuildManager) HandlePersistent(route string, handler PersistentHandlerFunc) {
+	mng.HandlePersistentContext(route, func(_ context.Context, i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData, state *PersistentState) (*discordgo.InteractionResponse, error) {
+		return handler(i, data, state)
+	})
+}
+
+// HandlePersistentContext is like HandlePersistent but the handler receives the context of its interaction
+func (mng *GuildManager) HandlePersistentContext(route string, handler PersistentContextHandlerFunc) {
+	mng.componentsMutex.Lock()
+	defer mng.componentsMutex.Unlock()
+	mng.persistentHandlers[route] = handler
+}
+
+// NewPersistentState stores the state for a set of persistent components handled by the given route name
+// Components using the custom IDs of the returned state keep working after a restart
+func (mng *GuildManager) NewPersistentState(route string, value interface{}) (*PersistentState, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	record := &ComponentState{
+		ID:      utils.RandomId(8),
+		GuildID: mng.guild.ID,
+		Route:   route,
+		Data:    string(raw),
+	}
+	state := &PersistentState{mng: mng, record: record}
+	// ensure that the custom IDs of the state fit before storing it
+	if _, err := state.CustomID(""); err != nil {
+		return nil, fmt.Errorf("invalid route name '%s': %w", route, err)
+	}
+	if err := mng.Connection().Create(record).Error; err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// DeletePersistentStates removes the states of every persistent component attached to the message
+func (mng *GuildManager) DeletePersistentStates(messageId string) error {
+	return mng.Connection().Where("guild_id = ? AND message_id = ?", mng.guild.ID, messageId).Delete(&ComponentState{}).Error
+}
+
+// handlePersistentComponent restores the state of a persistent component and passes it to its handler
+func (mng *GuildManager) handlePersistentComponent(ctx context.Context, i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData, params component.Params) (*discordgo.InteractionResponse, error) {
+	mng.componentsMutex.RLock()
+	handler, ok := mng.persistentHandlers[params.Get("route")]
+	mng.componentsMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no handler registered for persistent component '%s'", params.Get("route"))
+	}
+
+	var record ComponentState
+	if mng.Connection().WithContext(ctx).Where("id = ? AND guild_id = ?", params.Get("state"), mng.guild.ID).Limit(1).Find(&record).RowsAffected == 0 {
+		return utils.EphemeralResponse(utils.InfoAsEmbed("This component is no longer available.")), nil
+	}
+	if record.Route != params.Get("route") {
+		return nil, errors.New("component does not match its stored state")
+	}
+	state := &PersistentState{mng: mng, record: &record, action: params.Get("action")}
+	if record.MessageID == "" && i.Message != nil {
+		if err := state.BindMessage(i.Message.ID); err != nil {
+			mng.logger.Warn("Failed to bind persistent component to message", "error", err)
+		}
+	}
+	return handler(ctx, i, data, state)
+}
+
+// onPersistentMessageDelete removes the states of persistent components when their message is deleted
+func (mng *GuildManager) onPersistentMessageDelete(_ *discordgo.Session, event *discordgo.MessageDelete) {
+	if err := mng.DeletePersistentStates(event.ID); err != nil {
+		mng.logger.Error("Failed to delete persistent component states", "message", event.ID, "error", err)
+	}
+}
@@ -0,0 +1,386 @@
+package fuse
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/sylvrs/fuse/notify"
+	"gorm.io/gorm"
+)
+
+// ErrConfigConflict is returned when a service configuration was modified by someone else since it was fetched
+var ErrConfigConflict = errors.New("service configuration was modified concurrently")
+
+const (
+	// configUpdateAttempts is the number of times UpdateServiceConfig will retry an update after a conflict
+	configUpdateAttempts = 3
+)
+
+// configEntry is a single cached service configuration
+type configEntry struct {
+	// value is a pointer to the cached configuration
+	value reflect.Value
+	// dirty is true if the value has been changed but not yet written to the database
+	dirty bool
+	// stored is the version of the configuration in the database
+	// Under write-behind, the version of the cached value is bumped by every queued change and runs ahead of it
+	stored uint64
+}
+
+// versionOf returns the version metadata of a pointer to a configuration, if it is versioned
+func versionOf(pointer reflect.Value) (*ServiceConfiguration, bool) {
+	versioned, ok := pointer.Interface().(versionedConfiguration)
+	if !ok {
+		return nil, false
+	}
+	return versioned.serviceConfiguration(), true
+}
+
+// configCache holds the service configurations of a single guild, keyed by their type
+type configCache struct {
+	mutex   sync.Mutex
+	entries map[reflect.Type]*configEntry
+}
+
+func newConfigCache() *configCache {
+	return &configCache{entries: make(map[reflect.Type]*configEntry)}
+}
+
+// get copies the cached configuration into dst and returns true if it was found
+func (c *configCache) get(dst reflect.Value) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[dst.Type()]
+	if !ok {
+		return false
+	}
+	copyConfig(dst, entry.value.Elem())
+	return true
+}
+
+// set stores a copy of the configuration in the cache
+func (c *configCache) set(src reflect.Value, dirty bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	value := reflect.New(src.Type())
+	copyConfig(value.Elem(), src)
+	entry := &configEntry{value: value, dirty: dirty}
+	if meta, ok := versionOf(value); ok {
+		entry.stored = meta.Version
+	}
+	c.entries[src.Type()] = entry
+}
+
+// queue stores a copy of the configuration in the cache and marks it to be written later
+// If checkVersion is true, the configuration must be based on the cached version
+// Every queued change bumps the cached version, and the version of src if it is addressable,
+// so that a second change based on the same version is rejected before anything is written
+func (c *configCache) queue(src reflect.Value, checkVersion bool) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	value := reflect.New(src.Type())
+	copyConfig(value.Elem(), src)
+	meta, versioned := versionOf(value)
+	entry, ok := c.entries[src.Type()]
+	stored := uint64(0)
+	if ok {
+		stored = entry.stored
+		if cached, cachedOk := versionOf(entry.value); cachedOk && versioned {
+			if checkVersion && cached.Version != meta.Version {
+				return ErrConfigConflict
+			}
+			meta.Version = cached.Version
+		}
+	} else if versioned {
+		stored = meta.Version
+	}
+	if versioned {
+		meta.Version++
+		if src.CanAddr() {
+			if srcMeta, ok := versionOf(src.Addr()); ok {
+				srcMeta.Version = meta.Version
+			}
+		}
+	}
+	c.entries[src.Type()] = &configEntry{value: value, dirty: true, stored: stored}
+	return nil
+}
+
+// flushed updates the cache after a configuration was written to the database
+// The cached value is kept as is, since its version may have been handed out to callers, only the stored version is updated
+func (c *configCache) flushed(src reflect.Value) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[src.Type()]
+	if !ok {
+		return
+	}
+	if written, ok := versionOf(src.Addr()); ok {
+		entry.stored = written.Version
+	}
+}
+
+// types returns the types of all cached configurations
+func (c *configCache) types() []reflect.Type {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	types := make([]reflect.Type, 0, len(c.entries))
+	for t := range c.entries {
+		types = append(types, t)
+	}
+	return types
+}
+
+// delete removes the configuration of the given type from the cache
+func (c *configCache) delete(t reflect.Type) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, t)
+}
+
+// evict removes the configuration of the given type from the cache
+// If it has pending changes, a copy carrying the stored version is returned so that they can still be written
+func (c *configCache) evict(t reflect.Type) (reflect.Value, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[t]
+	delete(c.entries, t)
+	if !ok || !entry.dirty {
+		return reflect.Value{}, false
+	}
+	return entry.pending(), true
+}
+
+// clear removes every configuration from the cache and returns copies of the ones with pending changes
+func (c *configCache) clear() []reflect.Value {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	values := make([]reflect.Value, 0)
+	for _, entry := range c.entries {
+		if entry.dirty {
+			values = append(values, entry.pending())
+		}
+	}
+	c.entries = make(map[reflect.Type]*configEntry)
+	return values
+}
+
+// pending returns a copy of the entry's value carrying the stored version, ready to be written with a version check
+func (e *configEntry) pending() reflect.Value {
+	value := reflect.New(e.value.Elem().Type())
+	copyConfig(value.Elem(), e.value.Elem())
+	if meta, ok := versionOf(value); ok {
+		meta.Version = e.stored
+	}
+	return value
+}
+
+// takeDirty returns copies of all dirty configurations and marks them as clean
+// The copies carry the stored version so that they are written with a version check against the database
+func (c *configCache) takeDirty() []reflect.Value {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	values := make([]reflect.Value, 0)
+	for _, entry := range c.entries {
+		if !entry.dirty {
+			continue
+		}
+		values = append(values, entry.pending())
+		entry.dirty = false
+	}
+	return values
+}
+
+// copyConfig copies src into dst, duplicating slices so the copies do not share memory
+func copyConfig(dst, src reflect.Value) {
+	dst.Set(src)
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.Slice:
+			if field.IsNil() {
+				continue
+			}
+			copied := reflect.MakeSlice(field.Type(), field.Len(), field.Len())
+			reflect.Copy(copied, field)
+			field.Set(copied)
+		case reflect.Struct:
+			copyConfig(field, src.Field(i))
+		}
+	}
+}
+
+// configValue returns the struct value behind a configuration passed by value or by pointer
+func configValue(config interface{}) (reflect.Value, error) {
+	value := reflect.Indirect(reflect.ValueOf(config))
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("service configuration must be a struct, got %T", config)
+	}
+	return value, nil
+}
+
+// saveVersioned saves the configuration only if its version matches the one in the database
+func (mng *GuildManager) saveVersioned(db *gorm.DB, config interface{}, meta *ServiceConfiguration) error {
+	current := meta.Version
+	meta.Version = current + 1
+	result := db.Model(config).Where("version = ?", current).Select("*").Updates(config)
+	if result.Error != nil {
+		meta.Version = current
+		return result.Error
+	}
+	if result.RowsAffected != 0 {
+		return nil
+	}
+	// no rows were updated, either because the row does not exist yet or because the version changed
+	var count int64
+	if err := db.Model(config).Where("guild_id = ?", meta.GuildId).Count(&count).Error; err != nil {
+		meta.Version = current
+		return err
+	}
+	if count != 0 {
+		meta.Version = current
+		return ErrConfigConflict
+	}
+	return db.Create(config).Error
+}
+
+// writeConfig writes the configuration using db, bumping its version if it is versioned
+func (mng *GuildManager) writeConfig(db *gorm.DB, config interface{}) error {
+	versioned, ok := config.(versionedConfiguration)
+	if !ok {
+		return db.Save(config).Error
+	}
+	meta := versioned.serviceConfiguration()
+	if meta.GuildId == "" {
+		meta.GuildId = mng.guild.ID
+	}
+	return mng.saveVersioned(db, config, meta)
+}
+
+// InvalidateServiceConfig removes the cached configuration of the same type as config
+// Pending changes are written first, and are rejected with ErrConfigConflict if the stored configuration changed meanwhile
+// The next fetch will read the configuration from the database again
+func (mng *GuildManager) InvalidateServiceConfig(config interface{}) error {
+	value, err := configValue(config)
+	if err != nil {
+		return err
+	}
+	return mng.invalidateConfigType(value.Type())
+}
+
+// invalidateConfigType removes the cached configuration of the given type, writing its pending changes first
+func (mng *GuildManager) invalidateConfigType(t reflect.Type) error {
+	if pending, ok := mng.configs.evict(t); ok {
+		return mng.flushConfig(pending)
+	}
+	return nil
+}
+
+// InvalidateServiceConfigs removes every cached configuration for the guild, writing pending changes first
+func (mng *GuildManager) InvalidateServiceConfigs() error {
+	var errs []error
+	for _, value := range mng.configs.clear() {
+		errs = append(errs, mng.flushConfig(value))
+	}
+	return errors.Join(errs...)
+}
+
+// FlushServiceConfigs writes all pending configuration changes to the database
+// This is only needed when write-behind is enabled, otherwise changes are written immediately
+func (mng *GuildManager) FlushServiceConfigs() error {
+	var errs []error
+	for _, value := range mng.configs.takeDirty() {
+		errs = append(errs, mng.flushConfig(value))
+	}
+	return errors.Join(errs...)
+}
+
+// flushConfig writes a pending configuration change to the database
+func (mng *GuildManager) flushConfig(value reflect.Value) error {
+	config := value.Interface()
+	if err := mng.writeConfig(mng.Connection(), config); err != nil {
+		// our pending change is based on an outdated version, so the cached value can no longer be trusted
+		mng.configs.delete(value.Elem().Type())
+		mng.logger.Error("Failed to write service configuration", "config", value.Elem().Type().Name(), "error", err)
+		return err
+	}
+	mng.configs.flushed(value.Elem())
+	mng.publishChange(notify.KindServiceConfig, config)
+	return nil
+}
+
+// startConfigFlusher periodically flushes pending configuration changes until stopConfigFlusher is called
+func (mng *GuildManager) startConfigFlusher(interval time.Duration) {
+	mng.flushStop = make(chan struct{})
+	mng.flushDone = make(chan struct{})
+	go func() {
+		defer close(mng.flushDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				mng.FlushServiceConfigs()
+			case <-mng.flushStop:
+				return
+			}
+		}
+	}()
+}
+
+// stopConfigFlusher stops the flusher and writes any remaining changes
+func (mng *GuildManager) stopConfigFlusher() error {
+	if mng.flushStop != nil {
+		close(mng.flushStop)
+		<-mng.flushDone
+		mng.flushStop = nil
+	}
+	return mng.FlushServiceConfigs()
+}
+
+// ServiceConfig returns a copy of the service configuration of type T for the guild
+// The configuration is served from the guild's cache and fetched from the database on first use
+func ServiceConfig[T any](mng *GuildManager, defaults ...T) (*T, error) {
+	config := new(T)
+	if err := mng.FetchServiceConfig(config, toInterfaces(defaults)...); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// UpdateServiceConfig applies update to the latest service configuration of type T and saves it
+// If the configuration is modified concurrently, update is called again with the fresh configuration
+func UpdateServiceConfig[T any](mng *GuildManager, update func(config *T) error) (*T, error) {
+	for attempt := 0; attempt < configUpdateAttempts; attempt++ {
+		config, err := ServiceConfig[T](mng)
+		if err != nil {
+			return nil, err
+		}
+		if err := update(config); err != nil {
+			return nil, err
+		}
+		err = mng.SaveServiceConfig(config)
+		if err == nil {
+			return config, nil
+		}
+		if !errors.Is(err, ErrConfigConflict) {
+			return nil, err
+		}
+		mng.InvalidateServiceConfig(config)
+	}
+	return nil, ErrConfigConflict
+}
+
+func toInterfaces[T any](values []T) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
@@ -0,0 +1,205 @@
+package fuse
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glebarez/sqlite"
+)
+
+type cachedConfig struct {
+	ServiceConfiguration
+	Prefix   string
+	Channels StringArray `gorm:"type:text"`
+}
+
+func newCachedConfig(version uint64, prefix string) *cachedConfig {
+	return &cachedConfig{ServiceConfiguration: ServiceConfiguration{GuildId: "1", Version: version}, Prefix: prefix}
+}
+
+func newConfigGuildManager(t *testing.T, writeBehind time.Duration) *GuildManager {
+	t.Helper()
+	mng, err := NewManager(sqlite.Open(":memory:"), nil, &Config{Token: "token", ConfigWriteBehind: writeBehind})
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := mng.session.State.GuildAdd(&discordgo.Guild{ID: "1"}); err != nil {
+		t.Fatalf("failed to add guild: %v", err)
+	}
+	guildManager, err := CreateGuildManager(mng, &GuildConfiguration{GuildID: "1"})
+	if err != nil {
+		t.Fatalf("failed to create guild manager: %v", err)
+	}
+	return guildManager
+}
+
+func TestConfigCacheQueue(t *testing.T) {
+	tests := []struct {
+		name string
+		// versions are the versions of the configurations queued one after another on top of a cached version 1
+		versions     []uint64
+		checkVersion bool
+		// expected is the error expected for each queued configuration
+		expected []error
+		// cached is the version of the cached configuration once everything is queued
+		cached uint64
+	}{
+		{"single change", []uint64{1}, true, []error{nil}, 2},
+		{"changes based on each other", []uint64{1, 2, 3}, true, []error{nil, nil, nil}, 4},
+		{"second change based on the same version", []uint64{1, 1}, true, []error{nil, ErrConfigConflict}, 2},
+		{"change based on an outdated version", []uint64{0}, true, []error{ErrConfigConflict}, 1},
+		{"change without a version check", []uint64{1, 1}, false, []error{nil, nil}, 3},
+	}
+	for _, test := range tests {
+		cache := newConfigCache()
+		cache.set(reflect.ValueOf(*newCachedConfig(1, "!")), false)
+		for i, version := range test.versions {
+			config := newCachedConfig(version, "?")
+			err := cache.queue(reflect.ValueOf(config).Elem(), test.checkVersion)
+			if !errors.Is(err, test.expected[i]) {
+				t.Errorf("%s: queueing version %d returned %v, expected %v", test.name, version, err, test.expected[i])
+			}
+			if err == nil && config.Version != version+1 && test.checkVersion {
+				t.Errorf("%s: expected the queued configuration to be bumped to version %d, got %d", test.name, version+1, config.Version)
+			}
+		}
+		var cached cachedConfig
+		if !cache.get(reflect.ValueOf(&cached).Elem()) {
+			t.Fatalf("%s: expected the configuration to be cached", test.name)
+		}
+		if cached.Version != test.cached {
+			t.Errorf("%s: cached version is %d, expected %d", test.name, cached.Version, test.cached)
+		}
+	}
+}
+
+func TestConfigCacheTakeDirty(t *testing.T) {
+	cache := newConfigCache()
+	cache.set(reflect.ValueOf(*newCachedConfig(1, "!")), false)
+	if dirty := cache.takeDirty(); len(dirty) != 0 {
+		t.Fatalf("expected no dirty configurations, got %d", len(dirty))
+	}
+	for _, prefix := range []string{"?", "$"} {
+		var config cachedConfig
+		cache.get(reflect.ValueOf(&config).Elem())
+		config.Prefix = prefix
+		if err := cache.queue(reflect.ValueOf(&config).Elem(), true); err != nil {
+			t.Fatalf("failed to queue configuration: %v", err)
+		}
+	}
+
+	dirty := cache.takeDirty()
+	if len(dirty) != 1 {
+		t.Fatalf("expected 1 dirty configuration, got %d", len(dirty))
+	}
+	pending := dirty[0].Interface().(*cachedConfig)
+	// the pending copy carries the latest value but the stored version, so that it is written with a version check
+	if pending.Prefix != "$" || pending.Version != 1 {
+		t.Errorf("expected the pending configuration to have prefix $ and version 1, got %q and %d", pending.Prefix, pending.Version)
+	}
+	if dirty := cache.takeDirty(); len(dirty) != 0 {
+		t.Errorf("expected taking dirty configurations to mark them as clean, got %d", len(dirty))
+	}
+
+	// writing the pending copy bumps its version, which becomes the stored version of the cached configuration
+	pending.Version = 2
+	cache.flushed(dirty[0].Elem())
+	var config cachedConfig
+	cache.get(reflect.ValueOf(&config).Elem())
+	config.Prefix = "%"
+	if err := cache.queue(reflect.ValueOf(&config).Elem(), true); err != nil {
+		t.Fatalf("failed to queue configuration: %v", err)
+	}
+	if pending := cache.takeDirty()[0].Interface().(*cachedConfig); pending.Version != 2 {
+		t.Errorf("expected the next pending configuration to be based on stored version 2, got %d", pending.Version)
+	}
+}
+
+func TestConfigCacheCopiesSlices(t *testing.T) {
+	cache := newConfigCache()
+	config := newCachedConfig(1, "!")
+	config.Channels = StringArray{"1", "2"}
+	cache.set(reflect.ValueOf(config).Elem(), false)
+	config.Channels[0] = "changed"
+
+	var cached cachedConfig
+	cache.get(reflect.ValueOf(&cached).Elem())
+	if cached.Channels[0] != "1" {
+		t.Errorf("expected the cached configuration not to share memory with the saved one, got %v", cached.Channels)
+	}
+}
+
+func TestSaveServiceConfigConflict(t *testing.T) {
+	tests := []struct {
+		name        string
+		writeBehind time.Duration
+	}{
+		{"write-through", 0},
+		{"write-behind", time.Hour},
+	}
+	for _, test := range tests {
+		mng := newConfigGuildManager(t, test.writeBehind)
+		var first, second cachedConfig
+		if err := mng.FetchServiceConfig(&first); err != nil {
+			t.Fatalf("%s: failed to fetch config: %v", test.name, err)
+		}
+		if err := mng.FetchServiceConfig(&second); err != nil {
+			t.Fatalf("%s: failed to fetch config: %v", test.name, err)
+		}
+		first.Prefix = "!"
+		if err := mng.SaveServiceConfig(&first); err != nil {
+			t.Fatalf("%s: failed to save config: %v", test.name, err)
+		}
+		second.Prefix = "?"
+		if err := mng.SaveServiceConfig(&second); !errors.Is(err, ErrConfigConflict) {
+			t.Errorf("%s: expected saving an outdated config to conflict, got %v", test.name, err)
+		}
+		// the configuration saved first can be saved again as its version was bumped
+		first.Prefix = "$"
+		if err := mng.SaveServiceConfig(&first); err != nil {
+			t.Errorf("%s: failed to save config again: %v", test.name, err)
+		}
+		if err := mng.FlushServiceConfigs(); err != nil {
+			t.Fatalf("%s: failed to flush configs: %v", test.name, err)
+		}
+
+		var stored cachedConfig
+		if err := mng.Connection().Where("guild_id = ?", "1").First(&stored).Error; err != nil {
+			t.Fatalf("%s: failed to read config: %v", test.name, err)
+		}
+		if stored.Prefix != "$" {
+			t.Errorf("%s: expected the stored prefix to be $, got %q", test.name, stored.Prefix)
+		}
+	}
+}
+
+func TestFlushServiceConfigConflict(t *testing.T) {
+	mng := newConfigGuildManager(t, time.Hour)
+	config, err := ServiceConfig[cachedConfig](mng)
+	if err != nil {
+		t.Fatalf("failed to fetch config: %v", err)
+	}
+	config.Prefix = "!"
+	if err := mng.SaveServiceConfig(config); err != nil {
+		t.Fatalf("failed to queue config: %v", err)
+	}
+	// another process writes the configuration before the queued change is flushed
+	if err := mng.Connection().Model(&cachedConfig{}).Where("guild_id = ?", "1").Updates(map[string]interface{}{"prefix": "?", "version": 1}).Error; err != nil {
+		t.Fatalf("failed to update config: %v", err)
+	}
+	if err := mng.FlushServiceConfigs(); !errors.Is(err, ErrConfigConflict) {
+		t.Fatalf("expected flushing an outdated change to conflict, got %v", err)
+	}
+
+	// the rejected change is dropped from the cache, so the remote change is read again
+	fetched, err := ServiceConfig[cachedConfig](mng)
+	if err != nil {
+		t.Fatalf("failed to fetch config: %v", err)
+	}
+	if fetched.Prefix != "?" {
+		t.Errorf("expected the remote change to be fetched after the conflict, got %q", fetched.Prefix)
+	}
+}
@@ -0,0 +1,416 @@
+package fuse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/command"
+	"github.com/sylvrs/fuse/notify"
+	"github.com/sylvrs/fuse/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// ConfigExportVersion is the version of the export document produced by ExportConfigs
+	ConfigExportVersion = 1
+	// configCommandName is the name of the built-in export/import command
+	configCommandName = "config"
+	// maxImportSize is the maximum size of an uploaded export document
+	maxImportSize = 1 << 20
+	// maxDiffLength is the maximum length of a diff shown in an embed
+	maxDiffLength = 4000
+	// importDownloadTimeout is how long downloading an uploaded export document may take
+	importDownloadTimeout = 10 * time.Second
+)
+
+// importClient is the HTTP client used to download uploaded export documents
+var importClient = &http.Client{Timeout: importDownloadTimeout}
+
+// ConfigExport is a versioned document holding every service configuration of a guild
+type ConfigExport struct {
+	// Version is the version of the document format
+	Version int `json:"version"`
+	// GuildID is the ID of the guild the configurations were exported from
+	GuildID string `json:"guild_id"`
+	// ExportedAt is the time the document was created
+	ExportedAt time.Time `json:"exported_at"`
+	// Configs holds the configuration of every service, keyed by its table name
+	Configs map[string]map[string]json.RawMessage `json:"configs"`
+}
+
+// ConfigChange describes a single field that is changed by an import
+type ConfigChange struct {
+	Table string
+	Field string
+	Old   json.RawMessage
+	New   json.RawMessage
+}
+
+func (c ConfigChange) String() string {
+	return fmt.Sprintf("%s.%s: %s → %s", c.Table, c.Field, c.Old, c.New)
+}
+
+// configFields marshals a configuration into its fields, leaving out the guild ID and version
+func (mng *GuildManager) configFields(config interface{}) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	// these are specific to the guild and database row, so they are never exported
+	delete(fields, "GuildId")
+	delete(fields, "Version")
+	return fields, nil
+}
+
+// configTypesByTable returns every registered configuration type, keyed by its table name
+func (mng *GuildManager) configTypesByTable() (map[string]reflect.Type, error) {
+	types := make(map[string]reflect.Type)
+	for _, t := range mng.manager.ConfigTypes() {
+		table, err := mng.manager.tableName(reflect.New(t).Interface())
+		if err != nil {
+			return nil, err
+		}
+		types[table] = t
+	}
+	return types, nil
+}
+
+// readServiceConfig reads the service configuration from the guild's cache or the database without creating it
+// If the configuration has not been stored yet, config is left with its zero value
+func (mng *GuildManager) readServiceConfig(config interface{}) error {
+	value, err := configValue(config)
+	if err != nil {
+		return err
+	}
+	if mng.configs.get(value) {
+		return nil
+	}
+	if versioned, ok := config.(versionedConfiguration); ok {
+		versioned.serviceConfiguration().GuildId = mng.guild.ID
+	}
+	// the table of a configuration that has never been fetched may not exist yet
+	if !mng.Connection().Migrator().HasTable(config) {
+		return nil
+	}
+	return mng.Connection().Where("guild_id = ?", mng.guild.ID).Limit(1).Find(config).Error
+}
+
+// ExportConfigs exports every registered service configuration of the guild
+// Configurations that have not been stored yet are exported with their zero values without being created
+func (mng *GuildManager) ExportConfigs() (*ConfigExport, error) {
+	types, err := mng.configTypesByTable()
+	if err != nil {
+		return nil, err
+	}
+	export := &ConfigExport{
+		Version:    ConfigExportVersion,
+		GuildID:    mng.guild.ID,
+		ExportedAt: time.Now().UTC(),
+		Configs:    make(map[string]map[string]json.RawMessage),
+	}
+	for table, t := range types {
+		config := reflect.New(t).Interface()
+		if err := mng.readServiceConfig(config); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", table, err)
+		}
+		fields, err := mng.configFields(config)
+		if err != nil {
+			return nil, err
+		}
+		export.Configs[table] = fields
+	}
+	return export, nil
+}
+
+// ImportConfigs applies an exported document to the guild's service configurations
+// It returns every field that differs from the current configuration
+// If dryRun is true, the changes are only computed and nothing is saved
+func (mng *GuildManager) ImportConfigs(export *ConfigExport, dryRun bool) ([]ConfigChange, error) {
+	if export.Version < 1 || export.Version > ConfigExportVersion {
+		return nil, fmt.Errorf("unsupported export version %d", export.Version)
+	}
+	types, err := mng.configTypesByTable()
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		// write pending changes and read the configurations from the database, so that the import is based on their stored versions
+		if err := mng.InvalidateServiceConfigs(); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := make([]ConfigChange, 0)
+	pending := make([]interface{}, 0)
+	// decode every configuration before saving anything so that an invalid document does not leave a partial import
+	for table, imported := range export.Configs {
+		t, ok := types[table]
+		if !ok {
+			return nil, fmt.Errorf("unknown service configuration `%s`", table)
+		}
+		config := reflect.New(t).Interface()
+		if err := mng.readServiceConfig(config); err != nil {
+			return nil, err
+		}
+		current, err := mng.configFields(config)
+		if err != nil {
+			return nil, err
+		}
+		updates := make(map[string]json.RawMessage)
+		for field, value := range imported {
+			old, ok := current[field]
+			if !ok {
+				return nil, fmt.Errorf("unknown field `%s` in `%s`", field, table)
+			}
+			if bytes.Equal(compactJSON(old), compactJSON(value)) {
+				continue
+			}
+			updates[field] = value
+			changes = append(changes, ConfigChange{Table: table, Field: field, Old: old, New: value})
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		raw, err := json.Marshal(updates)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, config); err != nil {
+			return nil, fmt.Errorf("invalid values for `%s`: %w", table, err)
+		}
+		pending = append(pending, config)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Table != changes[j].Table {
+			return changes[i].Table < changes[j].Table
+		}
+		return changes[i].Field < changes[j].Field
+	})
+	if dryRun {
+		return changes, nil
+	}
+	// configurations that have never been fetched may not have a table yet
+	for _, config := range pending {
+		if err := mng.Connection().AutoMigrate(config); err != nil {
+			return nil, err
+		}
+	}
+	// save every configuration in a single transaction so that a failure does not leave a partial import
+	err = mng.Connection().Transaction(func(tx *gorm.DB) error {
+		for _, config := range pending {
+			if err := mng.writeConfig(tx, config); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, config := range pending {
+		value, _ := configValue(config)
+		mng.configs.set(value, false)
+		mng.publishChange(notify.KindServiceConfig, config)
+	}
+	if err := mng.RefreshServices(); err != nil {
+		mng.logger.Error("Failed to refresh services after importing configurations", "error", err)
+	}
+	return changes, nil
+}
+
+func compactJSON(raw json.RawMessage) []byte {
+	var buffer bytes.Buffer
+	if err := json.Compact(&buffer, raw); err != nil {
+		return raw
+	}
+	return buffer.Bytes()
+}
+
+// registerConfigCommand registers the built-in `/config` command used to export and import configurations
+func (mng *GuildManager) registerConfigCommand() {
+	if len(mng.manager.ConfigTypes()) == 0 {
+		return
+	}
+	fileOption := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionAttachment,
+		Name:        "file",
+		Description: "A configuration file created by /config export",
+		Required:    true,
+	}
+	permission := int64(discordgo.PermissionAdministrator)
+	mng.commandHandler.Register(&command.Command{
+		Name:               configCommandName,
+		Description:        "Export or import the configuration of this server",
+		DefaultPermissions: &permission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "export",
+				Description: "Export the configuration of every service as a file",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "diff",
+				Description: "Show what importing a configuration file would change",
+				Options:     []*discordgo.ApplicationCommandOption{fileOption},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "import",
+				Description: "Import a configuration file into this server",
+				Options:     []*discordgo.ApplicationCommandOption{fileOption},
+			},
+		},
+		ContextHandler: func(ctx context.Context, _ *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+			return mng.handleConfigCommand(ctx, i)
+		},
+	})
+}
+
+func (mng *GuildManager) handleConfigCommand(ctx context.Context, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return nil, errors.New("no subcommand was given")
+	}
+	subcommand := data.Options[0]
+	if subcommand.Name == "export" {
+		export, err := mng.ExportConfigs()
+		if err != nil {
+			return nil, err
+		}
+		raw, err := json.MarshalIndent(export, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Flags:  discordgo.MessageFlagsEphemeral,
+				Embeds: []*discordgo.MessageEmbed{utils.SuccessAsEmbed(fmt.Sprintf("Exported %d service %s", len(export.Configs), utils.Pluralize(len(export.Configs), "configuration", "configurations")))},
+				Files: []*discordgo.File{{
+					Name:        fmt.Sprintf("config-%s.json", mng.guild.ID),
+					ContentType: "application/json",
+					Reader:      bytes.NewReader(raw),
+				}},
+			},
+		}, nil
+	}
+
+	if len(subcommand.Options) == 0 {
+		return nil, errors.New("no file was given")
+	}
+	attachmentId, _ := subcommand.Options[0].Value.(string)
+	if data.Resolved == nil {
+		return nil, errors.New("the file could not be found")
+	}
+	attachment, ok := data.Resolved.Attachments[attachmentId]
+	if !ok {
+		return nil, errors.New("the file could not be found")
+	}
+	// downloading and applying the file may take longer than Discord waits for a response
+	err := mng.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	}, discordgo.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	embed, err := mng.importConfigFile(ctx, i, attachment, subcommand.Name == "diff")
+	if err != nil {
+		embed = utils.ErrorAsEmbed(err.Error())
+	}
+	if _, err := mng.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Embeds: &[]*discordgo.MessageEmbed{embed}}, discordgo.WithContext(ctx)); err != nil {
+		mng.logger.Error("Failed to edit deferred response", "error", err)
+	}
+	return nil, nil
+}
+
+// importConfigFile downloads the uploaded export document and applies it, or only previews it if dryRun is true
+func (mng *GuildManager) importConfigFile(ctx context.Context, i *discordgo.InteractionCreate, attachment *discordgo.MessageAttachment, dryRun bool) (*discordgo.MessageEmbed, error) {
+	export, err := downloadConfigExport(ctx, attachment)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := mng.ImportConfigs(export, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun && len(changes) != 0 {
+		before, after := make(map[string]json.RawMessage), make(map[string]json.RawMessage)
+		for _, change := range changes {
+			key := fmt.Sprintf("%s.%s", change.Table, change.Field)
+			before[key], after[key] = change.Old, change.New
+		}
+		mng.recordAudit(AuditEvent{
+			Action:      "config.import",
+			TargetType:  "config",
+			TargetID:    export.GuildID,
+			Before:      before,
+			After:       after,
+			Interaction: i.Interaction,
+		})
+	}
+
+	switch {
+	case len(changes) == 0:
+		return utils.InfoAsEmbed("The file matches the current configuration"), nil
+	case dryRun:
+		embed := utils.InfoAsEmbed(formatConfigChanges(changes))
+		embed.Title = "Import Preview"
+		return embed, nil
+	default:
+		return utils.SuccessAsEmbed(formatConfigChanges(changes)), nil
+	}
+}
+
+// downloadConfigExport downloads and decodes an export document uploaded as an attachment
+func downloadConfigExport(ctx context.Context, attachment *discordgo.MessageAttachment) (*ConfigExport, error) {
+	if attachment.Size > maxImportSize {
+		return nil, errors.New("the file is too large")
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, attachment.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := importClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download file: %s", response.Status)
+	}
+	var export ConfigExport
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxImportSize)).Decode(&export); err != nil {
+		return nil, fmt.Errorf("the file is not a valid configuration export: %w", err)
+	}
+	return &export, nil
+}
+
+// formatConfigChanges lists the changes, truncating the list if it is too long for an embed
+func formatConfigChanges(changes []ConfigChange) string {
+	var builder strings.Builder
+	for i, change := range changes {
+		line := fmt.Sprintf("- `%s`\n", change)
+		if builder.Len()+len(line) > maxDiffLength {
+			builder.WriteString(fmt.Sprintf("...and %d more", len(changes)-i))
+			break
+		}
+		builder.WriteString(line)
+	}
+	return builder.String()
+}
@@ -0,0 +1,176 @@
+package fuse
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/utils"
+)
+
+const (
+	// InteractionTimeout is how long Discord waits for the initial response to an interaction
+	// The deadline for the response of an interaction being handled is returned by ResponseDeadline
+	InteractionTimeout = 3 * time.Second
+	// InteractionTokenLifetime is how long the token of an interaction can be used for follow-up messages
+	// The context of an interaction kept alive with KeepAlive is cancelled once it has passed
+	InteractionTokenLifetime = 15 * time.Minute
+	// serviceStopTimeout is how long services are given to stop before their context expires
+	serviceStopTimeout = 10 * time.Second
+)
+
+type contextKey int
+
+const (
+	guildManagerKey contextKey = iota
+	interactionKey
+	responseDeadlineKey
+	lifetimeKey
+)
+
+// interactionLifetime keeps the context of an interaction alive while its handler runs and while it is kept alive with KeepAlive
+type interactionLifetime struct {
+	mutex    sync.Mutex
+	kept     int
+	finished bool
+	timer    *time.Timer
+	cancel   context.CancelFunc
+}
+
+// release cancels the context once the handler has returned and nothing keeps it alive anymore
+func (l *interactionLifetime) release() {
+	if l.finished && l.kept == 0 {
+		l.timer.Stop()
+		l.cancel()
+	}
+}
+
+// startInteraction creates the context for handling an interaction and makes it available through InteractionContext
+// The context carries the interaction's span and is cancelled once the handler returns, unless it is kept alive with KeepAlive
+// It is cancelled once the interaction token expires or the guild manager stops at the latest
+// The returned function must be called with the handler's error once the interaction has been responded to
+func (mng *Manager) startInteraction(guildManager *GuildManager, kind, name string, i *discordgo.InteractionCreate) (context.Context, func(err error)) {
+	parent := mng.ctx
+	if guildManager != nil && guildManager.ctx != nil {
+		parent = context.WithValue(guildManager.ctx, guildManagerKey, guildManager)
+	}
+	ctx := context.WithValue(parent, interactionKey, i)
+	ctx = context.WithValue(ctx, responseDeadlineKey, time.Now().Add(InteractionTimeout))
+	ctx, cancel := context.WithCancel(ctx)
+	lifetime := &interactionLifetime{cancel: cancel, timer: time.AfterFunc(InteractionTokenLifetime, cancel)}
+	ctx = context.WithValue(ctx, lifetimeKey, lifetime)
+	ctx, span := mng.tracer.Start(ctx, fmt.Sprintf("%s %s", kind, name),
+		"interaction.id", i.ID,
+		"interaction.type", kind,
+		"interaction.name", name,
+		"guild", i.GuildID,
+	)
+	if user := utils.InteractionUser(i.Interaction); user != nil {
+		span.SetAttributes("user", user.ID)
+	}
+	mng.interactionContexts.Store(i.ID, ctx)
+	return ctx, func(err error) {
+		mng.interactionContexts.Delete(i.ID)
+		span.RecordError(err)
+		span.End()
+		lifetime.mutex.Lock()
+		defer lifetime.mutex.Unlock()
+		lifetime.finished = true
+		lifetime.release()
+	}
+}
+
+// KeepAlive keeps the context of the interaction being handled alive after its handler returns
+// This is needed for work done in the background after a deferred response, e.g. sending follow-up messages
+// The returned function must be called once that work is done, the context is cancelled once the interaction token expires at the latest
+func KeepAlive(ctx context.Context) (done func()) {
+	lifetime, ok := ctx.Value(lifetimeKey).(*interactionLifetime)
+	if !ok {
+		return func() {}
+	}
+	lifetime.mutex.Lock()
+	lifetime.kept++
+	lifetime.mutex.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			lifetime.mutex.Lock()
+			defer lifetime.mutex.Unlock()
+			lifetime.kept--
+			lifetime.release()
+		})
+	}
+}
+
+// ResponseDeadline returns the time by which the initial response to the interaction being handled must be sent
+// Handlers doing slow work should send a deferred response before it has passed
+func ResponseDeadline(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Value(responseDeadlineKey).(time.Time)
+	return deadline, ok
+}
+
+// InteractionContext returns the context of an interaction while it is being handled
+// This allows handlers that do not take a context to pass it to database and REST calls
+// e.g. s.ChannelMessageSend(channelId, content, discordgo.WithContext(mng.InteractionContext(i)))
+func (mng *Manager) InteractionContext(i *discordgo.InteractionCreate) context.Context {
+	return mng.interactionContext(i.ID)
+}
+
+// interactionContext returns the context of the interaction with the given ID while it is being handled
+func (mng *Manager) interactionContext(id string) context.Context {
+	if ctx, ok := mng.interactionContexts.Load(id); ok {
+		return ctx.(context.Context)
+	}
+	return context.Background()
+}
+
+// InteractionContext returns the context of an interaction while it is being handled
+func (mng *GuildManager) InteractionContext(i *discordgo.InteractionCreate) context.Context {
+	return mng.manager.InteractionContext(i)
+}
+
+// Context returns a context that is cancelled when the guild manager stops
+func (mng *GuildManager) Context() context.Context {
+	if mng.ctx == nil {
+		return mng.manager.ctx
+	}
+	return mng.ctx
+}
+
+// GuildManagerFromContext returns the guild manager of the interaction being handled, or nil outside of guilds
+func GuildManagerFromContext(ctx context.Context) *GuildManager {
+	guildManager, _ := ctx.Value(guildManagerKey).(*GuildManager)
+	return guildManager
+}
+
+// InteractionFromContext returns the interaction being handled, or nil if there is none
+func InteractionFromContext(ctx context.Context) *discordgo.InteractionCreate {
+	i, _ := ctx.Value(interactionKey).(*discordgo.InteractionCreate)
+	return i
+}
+
+// MemberFromContext returns the member who invoked the interaction, or nil outside of guilds
+func MemberFromContext(ctx context.Context) *discordgo.Member {
+	if i := InteractionFromContext(ctx); i != nil {
+		return i.Member
+	}
+	return nil
+}
+
+// UserFromContext returns the user who invoked the interaction, both in guilds and in DMs
+func UserFromContext(ctx context.Context) *discordgo.User {
+	if i := InteractionFromContext(ctx); i != nil {
+		return utils.InteractionUser(i.Interaction)
+	}
+	return nil
+}
+
+// LocaleFromContext returns the locale of the user who invoked the interaction, or an empty locale if there is none
+func LocaleFromContext(ctx context.Context) discordgo.Locale {
+	if i := InteractionFromContext(ctx); i != nil {
+		return i.Locale
+	}
+	return ""
+}
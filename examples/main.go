@@ -15,6 +15,8 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/sylvrs/fuse"
 	"github.com/sylvrs/fuse/command"
+	"github.com/sylvrs/fuse/component"
+	"github.com/sylvrs/fuse/logging"
 	"github.com/sylvrs/fuse/utils"
 )
 
@@ -79,7 +81,7 @@ func main() {
 	}
 
 	dialector := sqlite.Open(envConfig.DatabaseName)
-	mng, err := fuse.NewManager(dialector, logger, &fuse.Config{
+	mng, err := fuse.NewManager(dialector, logging.FromLog15(logger), &fuse.Config{
 		Token: envConfig.Token,
 	})
 	if err != nil {
@@ -104,15 +106,18 @@ func main() {
 }
 
 // PingService is a service that responds to the ping command
-type PingService struct {
-	config PingServiceConfiguration
-}
+type PingService struct{}
 
 // PingServiceConfiguration represents a table in the database that holds the configuration for the ping service in each guild
 type PingServiceConfiguration struct {
-	fuse.ServiceConfiguration
-	RandomNumber int
-	CachedInput  fuse.StringArray `gorm:"type:TEXT"`
+	fuse.ServiceConfiguration `settings:"name:ping;description:Edit the settings of the ping service"`
+	RandomNumber              int              `settings:"description:A random number between 0 and 127;min:0;max:127"`
+	CachedInput               fuse.StringArray `gorm:"type:TEXT" settings:"description:The cached values;max_length:100"`
+}
+
+// Configs registers the configuration of the ping service so that /settings can show it right after a restart
+func (s *PingService) Configs() []interface{} {
+	return []interface{}{&PingServiceConfiguration{}}
 }
 
 func (s *PingService) Create(mng *fuse.GuildManager) (fuse.Service, error) {
@@ -126,7 +131,7 @@ func (s *PingService) Create(mng *fuse.GuildManager) (fuse.Service, error) {
 	}
 
 	logger.Info("Fetched number", "number", config.RandomNumber)
-	return &PingService{config: config}, nil
+	return &PingService{}, nil
 }
 
 func (s *PingService) Start(mng *fuse.GuildManager) error {
@@ -168,8 +173,13 @@ func (s *PingService) HandleCacheCommand(mng *fuse.GuildManager, i *discordgo.In
 		return nil, errors.New("Empty input given")
 	}
 
-	s.config.CachedInput = append(s.config.CachedInput, value)
-	mng.SaveServiceConfig(s.config)
+	_, err := fuse.UpdateServiceConfig(mng, func(config *PingServiceConfiguration) error {
+		config.CachedInput = append(config.CachedInput, value)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	return &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
@@ -182,20 +192,12 @@ func (s *PingService) HandleCacheCommand(mng *fuse.GuildManager, i *discordgo.In
 }
 
 func (s *PingService) HandleViewCacheCommand(mng *fuse.GuildManager, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
-	data := ""
-	for _, line := range s.config.CachedInput {
-		data += fmt.Sprintf("- %s\n", line)
+	config, err := fuse.ServiceConfig[PingServiceConfiguration](mng)
+	if err != nil {
+		return nil, err
 	}
 
-	return &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Embeds: []*discordgo.MessageEmbed{
-				utils.SuccessAsEmbed(data),
-			},
-		},
-	}, nil
-
+	return mng.Paginate(i, component.NewSlicePaginator("Cached values", config.CachedInput, component.DefaultItemsPerPage))
 }
 
 func (s *PingService) Stop(mng *fuse.GuildManager) error {
@@ -0,0 +1,302 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/component"
+	"github.com/sylvrs/fuse/modal"
+	"github.com/sylvrs/fuse/utils"
+)
+
+const (
+	// DefaultFlowTTL is how long a flow waits for the next answer when no TTL is provided
+	DefaultFlowTTL = 10 * time.Minute
+	// maxStepRows is the number of action rows a step may use, the last row is reserved for the navigation buttons
+	maxStepRows = 4
+)
+
+// RenderFunc returns the description and components of a step
+// Components must use the custom IDs returned by ctx.Handle
+type RenderFunc[T any] func(ctx *Context[T]) (string, []discordgo.MessageComponent, error)
+
+// CompleteFunc is called once the last step of a flow has been answered
+// If a nil response is returned, the flow is replaced with a short confirmation
+type CompleteFunc[T any] func(i *discordgo.InteractionCreate, state *T) (*discordgo.InteractionResponse, error)
+
+// Step is a single step of a flow
+type Step[T any] struct {
+	// Title is the title of the step's embed
+	Title string
+	// Render renders the step from the current state
+	Render RenderFunc[T]
+}
+
+// Flow is a wizard that walks a user through a series of steps, accumulating their answers in a state of type T
+// A flow is only a definition and can be started any number of times
+type Flow[T any] struct {
+	// Name is shown above the title of every step
+	Name string
+	// Steps are the steps of the flow in order
+	Steps []*Step[T]
+	// OnComplete is called with the final state once the last step has been answered
+	OnComplete CompleteFunc[T]
+	// OnAbandon is called with the state if the flow is cancelled or expires before completion
+	OnAbandon func(state *T)
+	// TTL is how long the flow waits for the next answer, DefaultFlowTTL is used if zero
+	TTL time.Duration
+	// Ephemeral makes the flow only visible to the user who started it
+	Ephemeral bool
+}
+
+// New creates a flow with the given steps
+func New[T any](name string, onComplete CompleteFunc[T], steps ...*Step[T]) *Flow[T] {
+	return &Flow[T]{Name: name, Steps: steps, OnComplete: onComplete}
+}
+
+// Start starts the flow for the user of the interaction and returns the response showing the first step
+// If state is nil, the flow starts with the zero value of T
+func (f *Flow[T]) Start(store *component.SessionStore, modals *modal.ModalHandler, i *discordgo.InteractionCreate, state *T) (*discordgo.InteractionResponse, error) {
+	if len(f.Steps) == 0 {
+		return nil, errors.New("flow has no steps")
+	}
+	if state == nil {
+		state = new(T)
+	}
+	ownerId := ""
+	if user := utils.InteractionUser(i.Interaction); user != nil {
+		ownerId = user.ID
+	}
+	ttl := f.TTL
+	if ttl <= 0 {
+		ttl = DefaultFlowTTL
+	}
+	ctx := &Context[T]{
+		State:   state,
+		flow:    f,
+		store:   store,
+		modals:  modals,
+		session: store.New(ownerId, ttl),
+	}
+	ctx.session.BindInteraction(i.Interaction)
+	ctx.session.OnExpire(func() {
+		if f.OnAbandon != nil {
+			f.OnAbandon(state)
+		}
+	})
+	ctx.session.Handle("back", func(i *discordgo.InteractionCreate, _ *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error) {
+		return ctx.Back(i)
+	})
+	ctx.session.Handle("cancel", func(i *discordgo.InteractionCreate, _ *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error) {
+		return ctx.Cancel(i)
+	})
+
+	data, err := ctx.render(0)
+	if err != nil {
+		ctx.session.Close()
+		return nil, err
+	}
+	data.Flags = utils.IfElse(f.Ephemeral, discordgo.MessageFlagsEphemeral, 0)
+	return &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: data}, nil
+}
+
+// Context is a single run of a flow
+type Context[T any] struct {
+	// State is the state accumulated by the answered steps
+	State *T
+
+	flow    *Flow[T]
+	store   *component.SessionStore
+	modals  *modal.ModalHandler
+	session *component.Session
+	mutex   sync.Mutex
+	step    int
+	history []int
+}
+
+// Step returns the index of the current step
+func (c *Context[T]) Step() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.step
+}
+
+// Handle registers the handler for a component of the current step and returns the custom ID to use for it
+func (c *Context[T]) Handle(name string, handler component.ComponentHandlerFunc) string {
+	return c.HandleContext(name, component.Adapt(handler))
+}
+
+// HandleContext is like Handle but the handler receives the context of its interaction
+func (c *Context[T]) HandleContext(name string, handler component.ContextHandlerFunc) string {
+	name = fmt.Sprintf("%d-%s", c.Step(), name)
+	c.session.HandleContext(name, handler)
+	return c.session.CustomID(name)
+}
+
+// CustomID returns a custom ID unique to the current step, e.g. to use as the ID of a modal
+func (c *Context[T]) CustomID(name string) string {
+	return c.session.CustomID(fmt.Sprintf("%d-%s", c.Step(), name))
+}
+
+// Modal sends a modal for the current step
+// The modal's handler should answer with Next, Back or Goto to keep the flow going
+// The given modal is not modified, so it can be reused
+func (c *Context[T]) Modal(i *discordgo.InteractionCreate, m *modal.Modal) (*discordgo.InteractionResponse, error) {
+	m = m.Clone()
+	// wrap whichever handler the modal dispatches to
+	switch {
+	case m.ContextHandler != nil:
+		handler := m.ContextHandler
+		m.ContextHandler = func(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+			if !c.active() {
+				return expiredResponse(), nil
+			}
+			return handler(ctx, s, i)
+		}
+	case m.OnSubmit != nil:
+		handler := m.OnSubmit
+		m.OnSubmit = func(s *discordgo.Session, i *discordgo.InteractionCreate, submission *modal.Submission) (*discordgo.InteractionResponse, error) {
+			if !c.active() {
+				return expiredResponse(), nil
+			}
+			return handler(s, i, submission)
+		}
+	case m.Handler != nil:
+		handler := m.Handler
+		m.Handler = func(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+			if !c.active() {
+				return expiredResponse(), nil
+			}
+			return handler(s, i)
+		}
+	}
+	return c.modals.Send(i, m)
+}
+
+// active returns whether the flow has not expired or been cancelled, e.g. while one of its modals was open
+func (c *Context[T]) active() bool {
+	_, ok := c.store.Get(c.session.ID())
+	return ok
+}
+
+func expiredResponse() *discordgo.InteractionResponse {
+	return utils.EphemeralResponse(utils.InfoAsEmbed("This interaction has expired."))
+}
+
+// Next moves to the next step, completing the flow if the current step is the last one
+func (c *Context[T]) Next(i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	step := c.Step()
+	if step == len(c.flow.Steps)-1 {
+		return c.complete(i)
+	}
+	return c.Goto(i, step+1)
+}
+
+// Goto moves to the step with the given index, which can be returned to with Back
+func (c *Context[T]) Goto(_ *discordgo.InteractionCreate, step int) (*discordgo.InteractionResponse, error) {
+	if step < 0 || step >= len(c.flow.Steps) {
+		return nil, fmt.Errorf("step %d out of range", step)
+	}
+	c.mutex.Lock()
+	c.history = append(c.history, c.step)
+	c.mutex.Unlock()
+	return c.update(step)
+}
+
+// Back returns to the previously shown step
+// The answers given since then are kept in the state until they are answered again
+func (c *Context[T]) Back(_ *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	c.mutex.Lock()
+	if len(c.history) == 0 {
+		c.mutex.Unlock()
+		return nil, errors.New("there is no previous step")
+	}
+	step := c.history[len(c.history)-1]
+	c.history = c.history[:len(c.history)-1]
+	c.mutex.Unlock()
+	return c.update(step)
+}
+
+// Refresh renders the current step again, e.g. after the state was changed without moving on
+func (c *Context[T]) Refresh(_ *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	return c.update(c.Step())
+}
+
+// Cancel abandons the flow
+func (c *Context[T]) Cancel(_ *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	c.session.Close()
+	if c.flow.OnAbandon != nil {
+		c.flow.OnAbandon(c.State)
+	}
+	return c.finish(utils.InfoAsEmbed("Cancelled.")), nil
+}
+
+// complete ends the flow and passes the final state to OnComplete
+func (c *Context[T]) complete(i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	c.session.Close()
+	if c.flow.OnComplete != nil {
+		response, err := c.flow.OnComplete(i, c.State)
+		if err != nil || response != nil {
+			return response, err
+		}
+	}
+	return c.finish(utils.SuccessAsEmbed("Done.")), nil
+}
+
+// finish returns the response replacing the flow with the embed
+func (c *Context[T]) finish(embed *discordgo.MessageEmbed) *discordgo.InteractionResponse {
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: []discordgo.MessageComponent{},
+		},
+	}
+}
+
+// update moves to the step and returns the response updating the message
+func (c *Context[T]) update(step int) (*discordgo.InteractionResponse, error) {
+	data, err := c.render(step)
+	if err != nil {
+		return nil, err
+	}
+	c.session.Extend()
+	return &discordgo.InteractionResponse{Type: discordgo.InteractionResponseUpdateMessage, Data: data}, nil
+}
+
+// render renders the step along with the navigation buttons
+func (c *Context[T]) render(step int) (*discordgo.InteractionResponseData, error) {
+	c.mutex.Lock()
+	c.step = step
+	first := len(c.history) == 0
+	c.mutex.Unlock()
+
+	current := c.flow.Steps[step]
+	description, components, err := current.Render(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(components) > maxStepRows {
+		return nil, fmt.Errorf("step '%s' has more than %d rows", current.Title, maxStepRows)
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       current.Title,
+		Description: description,
+		Color:       utils.ColorPrimary,
+		Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Step %d of %d", step+1, len(c.flow.Steps))},
+	}
+	if c.flow.Name != "" {
+		embed.Author = &discordgo.MessageEmbedAuthor{Name: c.flow.Name}
+	}
+	return &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Components: append(components, component.Row(
+			&discordgo.Button{CustomID: c.session.CustomID("back"), Label: "Back", Style: discordgo.SecondaryButton, Disabled: first},
+			&discordgo.Button{CustomID: c.session.CustomID("cancel"), Label: "Cancel", Style: discordgo.DangerButton},
+		)),
+	}, nil
+}
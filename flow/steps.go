@@ -0,0 +1,106 @@
+package flow
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/component"
+	"github.com/sylvrs/fuse/modal"
+)
+
+// SelectStep creates a step asking the user to pick one of the options
+// apply stores the picked value in the state, if it returns an error the step is shown again
+func SelectStep[T any](title, prompt string, options []discordgo.SelectMenuOption, apply func(state *T, value string) error) *Step[T] {
+	return &Step[T]{
+		Title: title,
+		Render: func(ctx *Context[T]) (string, []discordgo.MessageComponent, error) {
+			customId := ctx.Handle("select", component.OnStringSelect(func(i *discordgo.InteractionCreate, values []string) (*discordgo.InteractionResponse, error) {
+				if err := apply(ctx.State, values[0]); err != nil {
+					return nil, err
+				}
+				return ctx.Next(i)
+			}))
+			return prompt, []discordgo.MessageComponent{component.Row(component.StringSelect(customId, title, options...))}, nil
+		},
+	}
+}
+
+// ChannelStep creates a step asking the user to pick a channel
+// If channel types are given, only channels of those types can be picked
+func ChannelStep[T any](title, prompt string, apply func(state *T, channel *discordgo.Channel) error, channelTypes ...discordgo.ChannelType) *Step[T] {
+	return &Step[T]{
+		Title: title,
+		Render: func(ctx *Context[T]) (string, []discordgo.MessageComponent, error) {
+			customId := ctx.Handle("channel", component.OnChannelSelect(func(i *discordgo.InteractionCreate, channels []*discordgo.Channel) (*discordgo.InteractionResponse, error) {
+				if err := apply(ctx.State, channels[0]); err != nil {
+					return nil, err
+				}
+				return ctx.Next(i)
+			}))
+			return prompt, []discordgo.MessageComponent{component.Row(component.ChannelSelect(customId, title, channelTypes...))}, nil
+		},
+	}
+}
+
+// RoleStep creates a step asking the user to pick a role
+func RoleStep[T any](title, prompt string, apply func(state *T, role *discordgo.Role) error) *Step[T] {
+	return &Step[T]{
+		Title: title,
+		Render: func(ctx *Context[T]) (string, []discordgo.MessageComponent, error) {
+			customId := ctx.Handle("role", component.OnRoleSelect(func(i *discordgo.InteractionCreate, roles []*discordgo.Role) (*discordgo.InteractionResponse, error) {
+				if err := apply(ctx.State, roles[0]); err != nil {
+					return nil, err
+				}
+				return ctx.Next(i)
+			}))
+			return prompt, []discordgo.MessageComponent{component.Row(component.RoleSelect(customId, title))}, nil
+		},
+	}
+}
+
+// TextStep creates a step asking the user to enter text in a modal opened by a button
+// value returns the current text of the state, which is used to prefill the input
+func TextStep[T any](title, prompt string, input discordgo.TextInput, value func(state *T) string, apply func(state *T, text string) error) *Step[T] {
+	return &Step[T]{
+		Title: title,
+		Render: func(ctx *Context[T]) (string, []discordgo.MessageComponent, error) {
+			customId := ctx.Handle("open", func(i *discordgo.InteractionCreate, _ *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error) {
+				input := input
+				if value != nil {
+					input.Value = value(ctx.State)
+				}
+				return ctx.Modal(i, modal.NewTextModal(ctx.CustomID("modal"), title, []discordgo.TextInput{input}, func(_ *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+					text := ""
+					for _, row := range i.ModalSubmitData().Components {
+						if row, ok := row.(*discordgo.ActionsRow); ok && len(row.Components) != 0 {
+							if submitted, ok := row.Components[0].(*discordgo.TextInput); ok {
+								text = submitted.Value
+							}
+						}
+					}
+					if err := apply(ctx.State, text); err != nil {
+						return nil, err
+					}
+					return ctx.Next(i)
+				}))
+			})
+			return prompt, []discordgo.MessageComponent{component.Row(
+				&discordgo.Button{CustomID: customId, Label: input.Label, Style: discordgo.PrimaryButton},
+			)}, nil
+		},
+	}
+}
+
+// ConfirmStep creates a step showing a summary of the state with a button to complete the flow
+// It is meant to be the last step of a flow
+func ConfirmStep[T any](title string, summary func(state *T) string) *Step[T] {
+	return &Step[T]{
+		Title: title,
+		Render: func(ctx *Context[T]) (string, []discordgo.MessageComponent, error) {
+			customId := ctx.Handle("confirm", func(i *discordgo.InteractionCreate, _ *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error) {
+				return ctx.Next(i)
+			})
+			return summary(ctx.State), []discordgo.MessageComponent{component.Row(
+				&discordgo.Button{CustomID: customId, Label: "Confirm", Style: discordgo.SuccessButton},
+			)}, nil
+		},
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/sylvrs/fuse
 
-go 1.20
+go 1.21
 
 require (
 	github.com/bwmarrin/discordgo v0.28.1
@@ -1,13 +1,22 @@
 package fuse
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
-	log "github.com/inconshreveable/log15"
 	"github.com/sylvrs/fuse/command"
 	"github.com/sylvrs/fuse/component"
+	"github.com/sylvrs/fuse/flow"
+	"github.com/sylvrs/fuse/logging"
 	"github.com/sylvrs/fuse/modal"
+	"github.com/sylvrs/fuse/notify"
+	"github.com/sylvrs/fuse/tracing"
 	"github.com/sylvrs/fuse/utils"
 	"gorm.io/gorm"
 )
@@ -16,12 +25,20 @@ import (
 type GuildConfiguration struct {
 	// GuildID is the ID of the guild and is used as the primary key
 	GuildID string `gorm:"primarykey"`
+	// LeftAt is the time the bot left the guild, or nil if it is still a member
+	// The guild's data is purged once the retention period has passed
+	LeftAt *time.Time `gorm:"index"`
+	// LogChannelID is the ID of the channel the guild's logs are sent to, or empty if they are not sent to Discord
+	LogChannelID string
+	// LogLevel is the most verbose level sent to the log channel, DefaultGuildLogLevel is used if empty
+	LogLevel string
 }
 
 // GuildManager is the structure that manages all of the services for a single guild
 // It holds the guild's ID, its configuration, the database connection, and the Discord session
 type GuildManager struct {
-	logger             log.Logger
+	logger             *logging.Tee
+	configMutex        sync.RWMutex
 	config             *GuildConfiguration
 	manager            *Manager
 	connection         *gorm.DB
@@ -29,8 +46,26 @@ type GuildManager struct {
 	guild              *discordgo.Guild
 	commandHandler     *command.CommandHandler
 	modalHandler       *modal.ModalHandler
-	listenedComponents map[string]component.ComponentHandlerFunc
-	services           []Service
+	componentsMutex    sync.RWMutex
+	listenedComponents map[string]component.ContextHandlerFunc
+	componentRouter    *component.Router
+	componentSessions  *component.SessionStore
+	persistentHandlers map[string]PersistentContextHandlerFunc
+	services           []ContextService
+	servicesMutex      sync.Mutex
+	statusMutex        sync.Mutex
+	serviceStatuses    []ServiceStatus
+	handlersMutex      sync.Mutex
+	handlerRemovers    []func()
+	started            atomic.Bool
+	configs            *configCache
+	flushStop          chan struct{}
+	flushDone          chan struct{}
+	logMutex           sync.Mutex
+	logHandler         *utils.DiscordLogHandler
+	// ctx is cancelled when the guild manager stops
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func CreateGuildManager(manager *Manager, config *GuildConfiguration) (*GuildManager, error) {
@@ -44,7 +79,7 @@ func CreateGuildManager(manager *Manager, config *GuildConfiguration) (*GuildMan
 		return nil, err
 	}
 	guildManager := &GuildManager{
-		logger:             log.New("guild", config.GuildID),
+		logger:             logging.NewTee(manager.logger.With("guild", config.GuildID)),
 		config:             config,
 		manager:            manager,
 		connection:         manager.connection,
@@ -52,47 +87,150 @@ func CreateGuildManager(manager *Manager, config *GuildConfiguration) (*GuildMan
 		guild:              guild,
 		commandHandler:     commandHandler,
 		modalHandler:       modal.NewModalHandler(manager.session, guild),
-		listenedComponents: make(map[string]component.ComponentHandlerFunc),
-		services:           make([]Service, 0),
+		listenedComponents: make(map[string]component.ContextHandlerFunc),
+		componentRouter:    component.NewRouter(),
+		componentSessions:  component.NewSessionStore(manager.session),
+		persistentHandlers: make(map[string]PersistentContextHandlerFunc),
+		services:           make([]ContextService, 0),
+		configs:            newConfigCache(),
 	}
+	guildManager.componentRouter.HandleContext(component.SessionRoute, guildManager.componentSessions.HandleComponent)
+	guildManager.componentRouter.HandleContext(PersistentRoute, guildManager.handlePersistentComponent)
 	// register services to guild manager
 	services, err := manager.CreateServices(guildManager)
 	if err != nil {
 		return nil, err
 	}
 	guildManager.services = services
+	guildManager.serviceStatuses = utils.Map(services, func(s ContextService) ServiceStatus {
+		return ServiceStatus{Name: serviceName(s), State: ServiceCreated}
+	})
 	return guildManager, nil
 }
 
 // Start starts all of the services for the guild and registers all handlers, both component and command
 func (mng *GuildManager) Start() error {
-	for _, service := range mng.services {
-		if err := service.Start(mng); err != nil {
+	mng.ctx, mng.cancel = context.WithCancel(mng.manager.ctx)
+	mng.applyLogChannel()
+	mng.servicesMutex.Lock()
+	for index, service := range mng.services {
+		if !serviceEnabled(service, mng) {
+			mng.setServiceState(index, ServiceDisabled, nil)
+			continue
+		}
+		if err := mng.startService(index, service); err != nil {
+			mng.servicesMutex.Unlock()
 			return err
 		}
 	}
+	mng.servicesMutex.Unlock()
 
+	mng.registerSettingsCommand()
+	mng.registerConfigCommand()
+	mng.registerLoggingCommand()
+	mng.registerAuditCommand()
 	err := mng.commandHandler.Init()
 	if err != nil {
 		return err
 	}
 	mng.AddHandler(mng.handleListenedComponents)
+	mng.AddHandler(mng.onPersistentMessageDelete)
+	mng.componentSessions.Start()
+	mng.modalHandler.Start()
+	if interval := mng.manager.config.ConfigWriteBehind; interval > 0 {
+		mng.startConfigFlusher(interval)
+	}
+	mng.started.Store(true)
 	return nil
 }
 
 // Stop stops all of the services for the guild and deinitializes the command handler
 func (mng *GuildManager) Stop() error {
-	for _, service := range mng.services {
-		if err := service.Stop(mng); err != nil {
-			return err
+	mng.started.Store(false)
+	if mng.cancel != nil {
+		mng.cancel()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), serviceStopTimeout)
+	defer cancel()
+	// every service is stopped and the guild manager torn down even if a service fails to stop
+	var errs []error
+	mng.servicesMutex.Lock()
+	for index, service := range mng.services {
+		if mng.serviceState(index) == ServiceDisabled {
+			continue
+		}
+		if err := mng.stopService(ctx, index, service, ServiceStopped); err != nil {
+			errs = append(errs, err)
 		}
 	}
+	mng.servicesMutex.Unlock()
 
+	mng.removeHandlers()
 	mng.commandHandler.Deinit()
+	mng.componentSessions.Stop()
+	mng.modalHandler.Stop()
+	if err := mng.stopConfigFlusher(); err != nil {
+		errs = append(errs, err)
+	}
+	mng.closeLogChannel()
+	return errors.Join(errs...)
+}
+
+// RefreshServices starts the services that have been enabled and stops the services that have been disabled
+// It is called when a service configuration changes, including in other processes, and may be called by services
+// that change their configuration themselves. It must not be called from a service's Start or Stop
+func (mng *GuildManager) RefreshServices() error {
+	mng.servicesMutex.Lock()
+	defer mng.servicesMutex.Unlock()
+	if !mng.Started() {
+		return nil
+	}
+	var errs []error
+	for index, service := range mng.services {
+		enabled, state := serviceEnabled(service, mng), mng.serviceState(index)
+		switch {
+		case enabled && state == ServiceDisabled:
+			if err := mng.startService(index, service); err != nil {
+				errs = append(errs, fmt.Errorf("failed to start service '%s': %w", serviceName(service), err))
+				continue
+			}
+			mng.logger.Info("Started service as it was enabled", "service", serviceName(service))
+		case !enabled && state == ServiceRunning:
+			ctx, cancel := context.WithTimeout(context.Background(), serviceStopTimeout)
+			err := mng.stopService(ctx, index, service, ServiceDisabled)
+			cancel()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			mng.logger.Info("Stopped service as it was disabled", "service", serviceName(service))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// startService starts the service at the index and records its state
+func (mng *GuildManager) startService(index int, service ContextService) error {
+	if err := service.Start(mng.ctx, mng); err != nil {
+		mng.manager.metrics.serviceStartFailures.With(serviceName(service)).Inc()
+		mng.setServiceState(index, ServiceFailed, err)
+		return err
+	}
+	mng.setServiceState(index, ServiceRunning, nil)
+	return nil
+}
+
+// stopService stops the service at the index and records the provided state once it has stopped
+func (mng *GuildManager) stopService(ctx context.Context, index int, service ContextService, state ServiceState) error {
+	if err := service.Stop(ctx, mng); err != nil {
+		mng.setServiceState(index, ServiceFailed, err)
+		return fmt.Errorf("failed to stop service '%s': %w", serviceName(service), err)
+	}
+	mng.setServiceState(index, state, nil)
 	return nil
 }
 
-// FetchServiceConfig fetches the service configuration from the database
+// FetchServiceConfig fetches the service configuration from the guild's cache or the database
 // If the configuration does not exist, it will be created for the guild
 // An example of this in action would be like so:
 //
@@ -100,24 +238,115 @@ func (mng *GuildManager) Stop() error {
 // err := mng.FetchServiceConfig(&config)
 // ...
 func (mng *GuildManager) FetchServiceConfig(config interface{}, defaults ...interface{}) error {
-	mng.connection.AutoMigrate(config)
+	return mng.FetchServiceConfigContext(context.Background(), config, defaults...)
+}
+
+// FetchServiceConfigContext fetches the service configuration like FetchServiceConfig
+// The database query uses ctx and is traced as part of the span in ctx, e.g. the one of an interaction
+func (mng *GuildManager) FetchServiceConfigContext(ctx context.Context, config interface{}, defaults ...interface{}) (err error) {
+	value, err := configValue(config)
+	if err != nil {
+		return err
+	}
+	ctx, span := tracing.Start(ctx, "config fetch", "config.type", value.Type().Name())
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	mng.manager.registerConfigType(value.Type())
+	if mng.configs.get(value) {
+		span.SetAttributes("config.cached", true)
+		return nil
+	}
+	db := mng.Connection().WithContext(ctx)
+	db.AutoMigrate(config)
 	// Ensure that our guild ID is set in the service configuration
 	defaults = append(defaults, ServiceConfiguration{GuildId: mng.guild.ID})
-	return mng.Connection().Where("guild_id = ?", mng.guild.ID).Attrs(defaults...).FirstOrCreate(config).Error
+	if err := db.Where("guild_id = ?", mng.guild.ID).Attrs(defaults...).FirstOrCreate(config).Error; err != nil {
+		return err
+	}
+	mng.configs.set(value, false)
+	return nil
 }
 
-// SaveServiceConfig saves the service configuration to the database
+// SaveServiceConfig saves the service configuration to the database and updates the guild's cache
+// If the configuration embeds ServiceConfiguration and is passed by pointer, ErrConfigConflict is returned
+// when the configuration has been saved by someone else since it was fetched
+// Configurations passed by value are written without a version check
 func (mng *GuildManager) SaveServiceConfig(config interface{}) error {
-	return mng.Connection().Save(config).Error
+	return mng.SaveServiceConfigContext(context.Background(), config)
+}
+
+// SaveServiceConfigContext saves the service configuration like SaveServiceConfig
+// The database queries use ctx and are traced as part of the span in ctx, e.g. the one of an interaction
+func (mng *GuildManager) SaveServiceConfigContext(ctx context.Context, config interface{}) (err error) {
+	value, err := configValue(config)
+	if err != nil {
+		return err
+	}
+	ctx, span := tracing.Start(ctx, "config save", "config.type", value.Type().Name())
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	db := mng.Connection().WithContext(ctx)
+	byPointer := reflect.ValueOf(config).Kind() == reflect.Pointer
+	if mng.manager.config.ConfigWriteBehind > 0 {
+		return mng.configs.queue(value, byPointer)
+	}
+	if !byPointer {
+		// copy the configuration so that we can update its version
+		pointer := reflect.New(value.Type())
+		copyConfig(pointer.Elem(), value)
+		config, value = pointer.Interface(), pointer.Elem()
+		if versioned, ok := config.(versionedConfiguration); ok {
+			var versions []uint64
+			if err := db.Model(config).Where("guild_id = ?", mng.guild.ID).Pluck("version", &versions).Error; err != nil {
+				return err
+			}
+			if len(versions) != 0 {
+				versioned.serviceConfiguration().Version = versions[0]
+			}
+		}
+	}
+	if err := mng.writeConfig(db, config); err != nil {
+		return err
+	}
+	mng.configs.set(value, false)
+	mng.publishChange(notify.KindServiceConfig, config)
+	return nil
 }
 
 // Save saves the built-in guild configuration to the database
 func (mng *GuildManager) Save() error {
-	return mng.Connection().Save(mng.config).Error
+	return mng.updateConfig(func(*GuildConfiguration) {})
+}
+
+// updateConfig changes the built-in guild configuration and saves it to the database
+// The configuration is locked until it is saved, so that it is not replaced by a remote change in the meantime
+func (mng *GuildManager) updateConfig(update func(config *GuildConfiguration)) error {
+	mng.configMutex.Lock()
+	config := *mng.config
+	update(&config)
+	if err := mng.Connection().Save(&config).Error; err != nil {
+		mng.configMutex.Unlock()
+		return err
+	}
+	*mng.config = config
+	mng.configMutex.Unlock()
+	mng.publishChange(notify.KindGuildConfig, nil)
+	return nil
+}
+
+// guildConfig returns a copy of the built-in guild configuration
+func (mng *GuildManager) guildConfig() GuildConfiguration {
+	mng.configMutex.RLock()
+	defer mng.configMutex.RUnlock()
+	return *mng.config
 }
 
 // Logger returns the logger for the guild
-func (mng *GuildManager) Logger() log.Logger {
+func (mng *GuildManager) Logger() logging.Logger {
 	return mng.logger
 }
 
@@ -158,52 +387,61 @@ func (mng *GuildManager) ModalHandler() *modal.ModalHandler {
 
 // AddHandler is a wrapper for the session handler but limits the handler to only the guild
 // This may seem excessive but it is a good practice to prevent accidental checking of the wrong guild
+// Handlers are removed from the session when the guild manager stops
 func (mng *GuildManager) AddHandler(handler interface{}) {
+	var remove func()
 	switch handler := handler.(type) {
 	case func(s *discordgo.Session, i *discordgo.MessageCreate):
-		mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.MessageCreate) {
+		remove = mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.MessageCreate) {
 			if i.GuildID != mng.guild.ID {
 				return
 			}
 			handler(s, i)
 		})
 	case func(s *discordgo.Session, i *discordgo.InteractionCreate):
-		mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		remove = mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			if i.GuildID != mng.guild.ID {
 				return
 			}
 			handler(s, i)
 		})
 	case func(s *discordgo.Session, i *discordgo.GuildCreate):
-		mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.GuildCreate) {
+		remove = mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.GuildCreate) {
 			if i.Guild.ID != mng.guild.ID {
 				return
 			}
 			handler(s, i)
 		})
 	case func(s *discordgo.Session, i *discordgo.GuildDelete):
-		mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.GuildDelete) {
+		remove = mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.GuildDelete) {
 			if i.Guild.ID != mng.guild.ID {
 				return
 			}
 			handler(s, i)
 		})
 	case func(s *discordgo.Session, i *discordgo.GuildRoleUpdate):
-		mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.GuildRoleUpdate) {
+		remove = mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.GuildRoleUpdate) {
 			if i.GuildID != mng.guild.ID {
 				return
 			}
 			handler(s, i)
 		})
 	case func(s *discordgo.Session, i *discordgo.ChannelDelete):
-		mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.ChannelDelete) {
+		remove = mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.ChannelDelete) {
+			if i.GuildID != mng.guild.ID {
+				return
+			}
+			handler(s, i)
+		})
+	case func(s *discordgo.Session, i *discordgo.MessageDelete):
+		remove = mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.MessageDelete) {
 			if i.GuildID != mng.guild.ID {
 				return
 			}
 			handler(s, i)
 		})
 	case func(s *discordgo.Session, i *discordgo.GuildMemberAdd):
-		mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.GuildMemberAdd) {
+		remove = mng.session.AddHandler(func(s *discordgo.Session, i *discordgo.GuildMemberAdd) {
 			if i.GuildID != mng.guild.ID {
 				return
 			}
@@ -211,8 +449,21 @@ func (mng *GuildManager) AddHandler(handler interface{}) {
 		})
 	default:
 		mng.logger.Warn("guild handler will not check for guild id", "handler", handler)
-		mng.session.AddHandler(handler)
+		remove = mng.session.AddHandler(handler)
+	}
+	mng.handlersMutex.Lock()
+	mng.handlerRemovers = append(mng.handlerRemovers, remove)
+	mng.handlersMutex.Unlock()
+}
+
+// removeHandlers removes every handler added with AddHandler from the session
+func (mng *GuildManager) removeHandlers() {
+	mng.handlersMutex.Lock()
+	defer mng.handlersMutex.Unlock()
+	for _, remove := range mng.handlerRemovers {
+		remove()
 	}
+	mng.handlerRemovers = nil
 }
 
 func (mng *GuildManager) handleListenedComponents(s *discordgo.Session, i *discordgo.InteractionCreate) {
@@ -220,11 +471,27 @@ func (mng *GuildManager) handleListenedComponents(s *discordgo.Session, i *disco
 		return
 	}
 	data := i.MessageComponentData()
+	// custom IDs listened for are registered up front, so they are recorded as they are
+	name := data.CustomID
+	mng.componentsMutex.RLock()
 	handler, ok := mng.listenedComponents[data.CustomID]
+	mng.componentsMutex.RUnlock()
 	if !ok {
-		return
+		// fall back to the registered routes if no exact match was found
+		route, routeHandler, params, matched := mng.componentRouter.LookupContext(data.CustomID)
+		if !matched {
+			return
+		}
+		name = route.Pattern()
+		handler = func(ctx context.Context, i *discordgo.InteractionCreate, data *discordgo.MessageComponentInteractionData) (*discordgo.InteractionResponse, error) {
+			return routeHandler(ctx, i, data, params)
+		}
 	}
-	resp, err := handler(i, &data)
+	ctx, finish := mng.manager.startInteraction(mng, "component", name, i)
+	start := time.Now()
+	resp, err := handler(ctx, i, &data)
+	mng.manager.metrics.observeInteraction("component", name, start, err)
+	defer finish(err)
 	if err != nil {
 		mng.logger.Error("failed to handle component", "error", err)
 		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -233,11 +500,11 @@ func (mng *GuildManager) handleListenedComponents(s *discordgo.Session, i *disco
 				Flags:  discordgo.MessageFlagsEphemeral,
 				Embeds: []*discordgo.MessageEmbed{utils.ErrorAsEmbed(err.Error())},
 			},
-		})
+		}, discordgo.WithContext(ctx))
 		return
 	}
 	if resp != nil {
-		if err := s.InteractionRespond(i.Interaction, resp); err != nil {
+		if err := s.InteractionRespond(i.Interaction, resp, discordgo.WithContext(ctx)); err != nil {
 			mng.logger.Error("failed to respond to interaction", "error", err)
 		}
 	}
@@ -245,5 +512,63 @@ func (mng *GuildManager) handleListenedComponents(s *discordgo.Session, i *disco
 
 // ListenForComponent registers a handler for a specific component
 func (mng *GuildManager) ListenForComponent(customId string, handler component.ComponentHandlerFunc) {
+	mng.ListenForComponentContext(customId, component.Adapt(handler))
+}
+
+// ListenForComponentContext registers a handler for a specific component that receives the context of its interaction
+func (mng *GuildManager) ListenForComponentContext(customId string, handler component.ContextHandlerFunc) {
+	mng.componentsMutex.Lock()
+	defer mng.componentsMutex.Unlock()
 	mng.listenedComponents[customId] = handler
 }
+
+// ListenForRoute registers a handler for every component whose custom ID matches the pattern
+// Patterns are made of segments separated by colons, where segments in braces are parameters (e.g. `ticket:close:{id}`)
+// Custom IDs for a pattern can be created with component.Route.Encode
+func (mng *GuildManager) ListenForRoute(pattern string, handler component.RouteHandlerFunc) error {
+	return mng.componentRouter.Handle(pattern, handler)
+}
+
+// ListenForRouteContext is like ListenForRoute but the handler receives the context of its interaction
+func (mng *GuildManager) ListenForRouteContext(pattern string, handler component.RouteContextHandlerFunc) error {
+	return mng.componentRouter.HandleContext(pattern, handler)
+}
+
+// NewComponentSession creates a set of components that expires after the given lifetime
+// If ownerId is set, only that user may use the components and everyone else receives an ephemeral notice
+// Custom IDs for the session's components are created with Session.CustomID and handlers registered with Session.Handle
+func (mng *GuildManager) NewComponentSession(ownerId string, ttl time.Duration) *component.Session {
+	return mng.componentSessions.New(ownerId, ttl)
+}
+
+// Paginate returns the response showing the first page of the paginator and listens for its controls
+func (mng *GuildManager) Paginate(i *discordgo.InteractionCreate, paginator *component.Paginator) (*discordgo.InteractionResponse, error) {
+	return paginator.SendContext(mng.InteractionContext(i), mng.componentSessions, mng.modalHandler, i)
+}
+
+// Confirm returns an ephemeral confirmation prompt and calls callback once the user has answered it or it has timed out
+func (mng *GuildManager) Confirm(i *discordgo.InteractionCreate, options component.ConfirmOptions, callback component.ConfirmFunc) *discordgo.InteractionResponse {
+	return component.Confirm(mng.componentSessions, i, options, callback)
+}
+
+// AwaitConfirmation sends an ephemeral confirmation prompt as the response to the interaction and waits for the answer
+// The calling handler must return a nil response as the interaction has already been responded to
+func (mng *GuildManager) AwaitConfirmation(ctx context.Context, i *discordgo.InteractionCreate, options component.ConfirmOptions) (component.ConfirmOutcome, *discordgo.InteractionCreate, error) {
+	return component.AwaitConfirmation(ctx, mng.session, mng.componentSessions, i, options)
+}
+
+// StartFlow returns the response showing the first step of the flow and listens for the user's answers
+// If state is nil, the flow starts with the zero value of T
+func StartFlow[T any](mng *GuildManager, i *discordgo.InteractionCreate, f *flow.Flow[T], state *T) (*discordgo.InteractionResponse, error) {
+	return f.Start(mng.componentSessions, mng.modalHandler, i, state)
+}
+
+// ComponentSessions returns the store holding the guild's component sessions
+func (mng *GuildManager) ComponentSessions() *component.SessionStore {
+	return mng.componentSessions
+}
+
+// ComponentRouter returns the router used to dispatch components by pattern
+func (mng *GuildManager) ComponentRouter() *component.Router {
+	return mng.componentRouter
+}
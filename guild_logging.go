@@ -0,0 +1,204 @@
+package fuse
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/command"
+	"github.com/sylvrs/fuse/utils"
+)
+
+const (
+	// DefaultGuildLogLevel is the most verbose level sent to a guild's log channel when none is configured
+	DefaultGuildLogLevel = slog.LevelWarn
+	loggingCommandName   = "logging"
+)
+
+// logLevelChoices are the levels guild admins can pick for their log channel
+var logLevelChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Debug", Value: slog.LevelDebug.String()},
+	{Name: "Info", Value: slog.LevelInfo.String()},
+	{Name: "Warn", Value: slog.LevelWarn.String()},
+	{Name: "Error", Value: slog.LevelError.String()},
+}
+
+// logLevelName returns the name of the level as shown to guild admins
+func logLevelName(level slog.Level) string {
+	for _, choice := range logLevelChoices {
+		if choice.Value == level.String() {
+			return choice.Name
+		}
+	}
+	return level.String()
+}
+
+// LogLevel returns the most verbose level sent to the guild's log channel
+func (mng *GuildManager) LogLevel() slog.Level {
+	config := mng.guildConfig()
+	if config.LogLevel == "" {
+		return DefaultGuildLogLevel
+	}
+	level, err := parseLogLevel(config.LogLevel)
+	if err != nil {
+		return DefaultGuildLogLevel
+	}
+	return level
+}
+
+// parseLogLevel parses a stored log level, including the names stored before logging moved to slog
+func parseLogLevel(value string) (slog.Level, error) {
+	switch strings.ToLower(value) {
+	case "dbug":
+		return slog.LevelDebug, nil
+	case "eror", "crit":
+		return slog.LevelError, nil
+	}
+	var level slog.Level
+	err := level.UnmarshalText([]byte(value))
+	return level, err
+}
+
+// SetLogChannel sends the guild's log records at the given level or above to the channel
+// If channelId is empty, the guild's logs are no longer sent to Discord
+func (mng *GuildManager) SetLogChannel(channelId string, level slog.Level) error {
+	err := mng.updateConfig(func(config *GuildConfiguration) {
+		config.LogChannelID = channelId
+		config.LogLevel = level.String()
+	})
+	if err != nil {
+		return err
+	}
+	mng.applyLogChannel()
+	return nil
+}
+
+// applyLogChannel attaches a Discord log handler for the configured log channel to the guild's logger
+// Any previously attached handler is closed after sending its queued records
+func (mng *GuildManager) applyLogChannel() {
+	mng.logMutex.Lock()
+	defer mng.logMutex.Unlock()
+	if mng.logHandler != nil {
+		mng.logger.SetHandler(nil)
+		mng.logHandler.Close()
+		mng.logHandler = nil
+	}
+	channelId := mng.guildConfig().LogChannelID
+	if channelId == "" {
+		return
+	}
+	options := utils.DefaultDiscordLogOptions()
+	options.Level = mng.LogLevel()
+	options.OnError = func(err error) {
+		mng.logger.Warn("Failed to send logs to log channel", utils.SkipDiscordLogKey, true, "channel", channelId, "error", err)
+	}
+	mng.logHandler = utils.NewDiscordLogHandler(mng.session, mng.guild.ID, channelId, options)
+	mng.logger.SetHandler(mng.logHandler)
+}
+
+// closeLogChannel stops sending the guild's logs to Discord without changing its configuration
+func (mng *GuildManager) closeLogChannel() {
+	mng.logMutex.Lock()
+	defer mng.logMutex.Unlock()
+	if mng.logHandler != nil {
+		mng.logger.SetHandler(nil)
+		mng.logHandler.Close()
+		mng.logHandler = nil
+	}
+}
+
+func (mng *GuildManager) registerLoggingCommand() {
+	permission := int64(discordgo.PermissionAdministrator)
+	mng.commandHandler.Register(&command.Command{
+		Name:               loggingCommandName,
+		Description:        "Configure where the bot's logs for this server are sent",
+		DefaultPermissions: &permission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "channel",
+				Description: "Send the bot's logs to a channel",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "channel",
+						Description:  "The channel to send logs to",
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+						Required:     true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "level",
+						Description: fmt.Sprintf("The least severe level of logs to send (default: %s)", logLevelName(DefaultGuildLogLevel)),
+						Choices:     logLevelChoices,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "disable",
+				Description: "Stop sending the bot's logs to a channel",
+			},
+		},
+		Handler: func(_ *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+			return mng.handleLoggingCommand(i)
+		},
+	})
+}
+
+func (mng *GuildManager) handleLoggingCommand(i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return nil, errors.New("no subcommand was given")
+	}
+	subcommand := data.Options[0]
+	if subcommand.Name == "disable" {
+		previous := mng.guildConfig().LogChannelID
+		if previous == "" {
+			return utils.EphemeralResponse(utils.InfoAsEmbed("Logs are not being sent to a channel.")), nil
+		}
+		if err := mng.SetLogChannel("", mng.LogLevel()); err != nil {
+			return nil, err
+		}
+		mng.recordAudit(AuditEvent{Action: "logging.disable", TargetType: "channel", TargetID: previous, Interaction: i.Interaction})
+		return utils.EphemeralResponse(utils.SuccessAsEmbed("Logs are no longer sent to a channel.")), nil
+	}
+
+	var channel *discordgo.Channel
+	level := mng.LogLevel()
+	for _, option := range subcommand.Options {
+		switch option.Name {
+		case "channel":
+			channel = option.ChannelValue(nil)
+		case "level":
+			parsed, err := parseLogLevel(option.StringValue())
+			if err != nil {
+				return nil, err
+			}
+			level = parsed
+		}
+	}
+	if channel == nil {
+		return nil, errors.New("no channel was given")
+	}
+	before := map[string]string{"channel": mng.guildConfig().LogChannelID, "level": logLevelName(mng.LogLevel())}
+	if err := mng.SetLogChannel(channel.ID, level); err != nil {
+		return nil, err
+	}
+	mng.recordAudit(AuditEvent{
+		Action:      "logging.update",
+		TargetType:  "channel",
+		TargetID:    channel.ID,
+		Before:      before,
+		After:       map[string]string{"channel": channel.ID, "level": logLevelName(level)},
+		Interaction: i.Interaction,
+	})
+	// this is sent directly, as a log record could be filtered out by the channel's level
+	confirmation := utils.InfoAsEmbed(fmt.Sprintf("Logs for this server at level %s and above will be sent to this channel.", logLevelName(level)))
+	if _, err := mng.session.ChannelMessageSendEmbed(channel.ID, confirmation, discordgo.WithContext(mng.InteractionContext(i))); err != nil {
+		return nil, fmt.Errorf("logs will be sent to <#%s>, but a message could not be sent there: %w", channel.ID, err)
+	}
+	return utils.EphemeralResponse(utils.SuccessAsEmbed(fmt.Sprintf("Logs at level %s and above will be sent to <#%s>.", logLevelName(level), channel.ID))), nil
+}
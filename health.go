@@ -0,0 +1,203 @@
+package fuse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDisconnectThreshold is how long the gateway may be disconnected before the manager is reported as unhealthy
+	DefaultDisconnectThreshold = 2 * time.Minute
+	// healthCheckTimeout is how long health checks wait for the database to respond
+	healthCheckTimeout = 2 * time.Second
+)
+
+// ServiceState is the lifecycle state of a service in a guild
+type ServiceState string
+
+const (
+	// ServiceCreated means the service has been created but not started
+	ServiceCreated ServiceState = "created"
+	// ServiceRunning means the service has been started
+	ServiceRunning ServiceState = "running"
+	// ServiceFailed means the service failed to start or stop
+	ServiceFailed ServiceState = "failed"
+	// ServiceStopped means the service has been stopped
+	ServiceStopped ServiceState = "stopped"
+	// ServiceDisabled means the service is not running because it is disabled in the guild
+	ServiceDisabled ServiceState = "disabled"
+)
+
+// ServiceStatus is the state of a single service in a guild
+type ServiceStatus struct {
+	Name  string       `json:"name"`
+	State ServiceState `json:"state"`
+	// Error is the error the service failed with, if any
+	Error string `json:"error,omitempty"`
+}
+
+// GuildStatus is the state of a guild manager and its services
+type GuildStatus struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Services []ServiceStatus `json:"services"`
+}
+
+// GatewayStatus is the state of the connection to the Discord gateway
+type GatewayStatus struct {
+	Connected bool `json:"connected"`
+	// DisconnectedSince is when the gateway was disconnected, if it is not connected
+	DisconnectedSince *time.Time `json:"disconnected_since,omitempty"`
+	// Latency is the latency of the last heartbeat in milliseconds
+	Latency int64 `json:"latency_ms"`
+}
+
+// Status is a snapshot of the state of the manager as shown on the status page
+type Status struct {
+	// Ready is true once the manager has started and until it stops
+	Ready bool `json:"ready"`
+	// Healthy is true if there are no problems
+	Healthy  bool          `json:"healthy"`
+	Problems []string      `json:"problems,omitempty"`
+	Gateway  GatewayStatus `json:"gateway"`
+	Guilds   []GuildStatus `json:"guilds"`
+}
+
+// setGatewayConnected records whether the gateway is connected and since when it has been disconnected
+func (mng *Manager) setGatewayConnected(connected bool) {
+	mng.gatewayMutex.Lock()
+	defer mng.gatewayMutex.Unlock()
+	if mng.gatewayConnected && !connected {
+		mng.disconnectedSince = time.Now()
+	}
+	mng.gatewayConnected = connected
+}
+
+// gatewayStatus returns the state of the connection to the gateway
+func (mng *Manager) gatewayStatus() GatewayStatus {
+	mng.gatewayMutex.Lock()
+	defer mng.gatewayMutex.Unlock()
+	status := GatewayStatus{Connected: mng.gatewayConnected}
+	// the latency is only known once a heartbeat has been acknowledged
+	if !mng.session.LastHeartbeatAck.IsZero() {
+		status.Latency = mng.session.HeartbeatLatency().Milliseconds()
+	}
+	if !mng.gatewayConnected {
+		since := mng.disconnectedSince
+		status.DisconnectedSince = &since
+	}
+	return status
+}
+
+// Ready returns whether the manager has opened the session, loaded its guilds and started their services
+func (mng *Manager) Ready() bool {
+	return mng.ready.Load()
+}
+
+// CheckHealth returns the problems preventing the manager from working, or nil if it is healthy
+// The manager is unhealthy if the gateway has been disconnected for longer than the threshold or the database is unreachable
+func (mng *Manager) CheckHealth(ctx context.Context) []string {
+	var problems []string
+	threshold := mng.config.DisconnectThreshold
+	if threshold <= 0 {
+		threshold = DefaultDisconnectThreshold
+	}
+	if gateway := mng.gatewayStatus(); !gateway.Connected {
+		if disconnected := time.Since(*gateway.DisconnectedSince); disconnected > threshold {
+			problems = append(problems, fmt.Sprintf("gateway has been disconnected for %s", disconnected.Round(time.Second)))
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	database, err := mng.connection.DB()
+	if err == nil {
+		err = database.PingContext(ctx)
+	}
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("database is unreachable: %s", err))
+	}
+	return problems
+}
+
+// Status returns a snapshot of the state of the manager, its guild managers and their services
+func (mng *Manager) Status(ctx context.Context) Status {
+	problems := mng.CheckHealth(ctx)
+	status := Status{
+		Ready:    mng.Ready(),
+		Healthy:  len(problems) == 0,
+		Problems: problems,
+		Gateway:  mng.gatewayStatus(),
+		Guilds:   make([]GuildStatus, 0),
+	}
+	for _, guildManager := range mng.GuildManagers() {
+		status.Guilds = append(status.Guilds, GuildStatus{
+			ID:       guildManager.guild.ID,
+			Name:     guildManager.guild.Name,
+			Services: guildManager.ServiceStatuses(),
+		})
+	}
+	sort.Slice(status.Guilds, func(i, j int) bool { return status.Guilds[i].ID < status.Guilds[j].ID })
+	return status
+}
+
+// handleHealth responds with 200 if the manager is healthy and 503 with the problems otherwise
+func (mng *Manager) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if problems := mng.CheckHealth(r.Context()); len(problems) != 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, strings.Join(problems, "\n"))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReady responds with 200 once the manager is ready and 503 otherwise
+func (mng *Manager) handleReady(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !mng.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "not ready")
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// handleStatus responds with the status of the manager as JSON
+func (mng *Manager) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(mng.Status(r.Context())); err != nil {
+		mng.logger.Error("Failed to write status", "error", err)
+	}
+}
+
+// setServiceState records the state of the service at the given index
+func (mng *GuildManager) setServiceState(index int, state ServiceState, err error) {
+	mng.statusMutex.Lock()
+	defer mng.statusMutex.Unlock()
+	status := &mng.serviceStatuses[index]
+	status.State, status.Error = state, ""
+	if err != nil {
+		status.Error = err.Error()
+	}
+}
+
+// serviceState returns the state of the service at the index
+func (mng *GuildManager) serviceState(index int) ServiceState {
+	mng.statusMutex.Lock()
+	defer mng.statusMutex.Unlock()
+	return mng.serviceStatuses[index].State
+}
+
+// ServiceStatuses returns the state of every service of the guild
+func (mng *GuildManager) ServiceStatuses() []ServiceStatus {
+	mng.statusMutex.Lock()
+	defer mng.statusMutex.Unlock()
+	return append([]ServiceStatus(nil), mng.serviceStatuses...)
+}
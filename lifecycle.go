@@ -0,0 +1,167 @@
+package fuse
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/utils"
+)
+
+// GatewayFunc is called when the connection to the gateway changes
+type GatewayFunc func(mng *Manager)
+
+// ReadyFunc is called when the gateway session is ready, both on start and after a new session has been established
+type ReadyFunc func(mng *Manager, event *discordgo.Ready)
+
+// lifecycleHooks holds the functions registered for each gateway lifecycle event
+type lifecycleHooks struct {
+	connect    []GatewayFunc
+	disconnect []GatewayFunc
+	resumed    []GatewayFunc
+	ready      []ReadyFunc
+}
+
+// OnConnect registers a function that is called every time the gateway connects
+func (mng *Manager) OnConnect(f GatewayFunc) {
+	mng.hooksMutex.Lock()
+	defer mng.hooksMutex.Unlock()
+	mng.hooks.connect = append(mng.hooks.connect, f)
+}
+
+// OnDisconnect registers a function that is called every time the gateway disconnects
+func (mng *Manager) OnDisconnect(f GatewayFunc) {
+	mng.hooksMutex.Lock()
+	defer mng.hooksMutex.Unlock()
+	mng.hooks.disconnect = append(mng.hooks.disconnect, f)
+}
+
+// OnResumed registers a function that is called every time a gateway session is resumed
+// Events missed while disconnected are replayed by Discord after resuming
+func (mng *Manager) OnResumed(f GatewayFunc) {
+	mng.hooksMutex.Lock()
+	defer mng.hooksMutex.Unlock()
+	mng.hooks.resumed = append(mng.hooks.resumed, f)
+}
+
+// OnReady registers a function that is called every time a gateway session is ready
+// A new session is only established when a session could not be resumed, in which case events may have been missed
+func (mng *Manager) OnReady(f ReadyFunc) {
+	mng.hooksMutex.Lock()
+	defer mng.hooksMutex.Unlock()
+	mng.hooks.ready = append(mng.hooks.ready, f)
+}
+
+// lifecycleHooks returns a snapshot of the registered hooks
+func (mng *Manager) lifecycleHooks() lifecycleHooks {
+	mng.hooksMutex.Lock()
+	defer mng.hooksMutex.Unlock()
+	return mng.hooks
+}
+
+func (mng *Manager) onConnect(_ *discordgo.Session, _ *discordgo.Connect) {
+	mng.setGatewayConnected(true)
+	mng.logger.Info("Connected to gateway")
+	for _, f := range mng.lifecycleHooks().connect {
+		f(mng)
+	}
+}
+
+func (mng *Manager) onDisconnect(_ *discordgo.Session, _ *discordgo.Disconnect) {
+	mng.setGatewayConnected(false)
+	mng.logger.Warn("Disconnected from gateway")
+	for _, f := range mng.lifecycleHooks().disconnect {
+		f(mng)
+	}
+}
+
+func (mng *Manager) onResumed(_ *discordgo.Session, _ *discordgo.Resumed) {
+	mng.logger.Info("Resumed gateway session")
+	for _, f := range mng.lifecycleHooks().resumed {
+		f(mng)
+	}
+}
+
+func (mng *Manager) onReady(_ *discordgo.Session, event *discordgo.Ready) {
+	// the first session is opened before the guilds are loaded, so there is nothing to reconcile yet
+	if mng.Ready() {
+		guildIds := utils.Map(event.Guilds, func(guild *discordgo.Guild) string { return guild.ID })
+		if err := mng.reconcileGuilds(guildIds); err != nil {
+			mng.logger.Error("Failed to reconcile guilds", "error", err)
+		}
+	}
+	for _, f := range mng.lifecycleHooks().ready {
+		f(mng, event)
+	}
+}
+
+// ownsGuild returns whether the guild is handled by the shard of this manager's session
+func (mng *Manager) ownsGuild(guildId string) bool {
+	if mng.session.ShardCount <= 1 {
+		return true
+	}
+	id, err := strconv.ParseUint(guildId, 10, 64)
+	if err != nil {
+		return false
+	}
+	return int((id>>22)%uint64(mng.session.ShardCount)) == mng.session.ShardID
+}
+
+// reconcileGuilds brings the guild managers and the database in line with the guilds the bot is in
+// This catches up on guilds that were joined or left while the gateway was disconnected
+// Guilds that are not yet available are created once their GuildCreate event is received
+func (mng *Manager) reconcileGuilds(guildIds []string) error {
+	mng.reconcileMutex.Lock()
+	defer mng.reconcileMutex.Unlock()
+	current := make(map[string]bool, len(guildIds))
+	for _, id := range guildIds {
+		current[id] = true
+	}
+
+	created, left := 0, 0
+	// tear down the guild managers of guilds that were left
+	for _, guildManager := range mng.GuildManagers() {
+		if current[guildManager.guild.ID] {
+			continue
+		}
+		if err := mng.leaveGuild(guildManager.guild); err != nil {
+			mng.logger.Error("Failed to leave guild", "guild", guildManager.guild.ID, "error", err)
+			continue
+		}
+		left++
+	}
+	// mark guilds that were left as such, even if they had no guild manager
+	var stored []*GuildConfiguration
+	if err := mng.connection.Where("left_at IS NULL").Find(&stored).Error; err != nil {
+		return err
+	}
+	for _, config := range stored {
+		// guilds of other shards are never in this session's Ready event, so they must not be marked as left
+		if current[config.GuildID] || mng.GuildExists(config.GuildID) || !mng.ownsGuild(config.GuildID) {
+			continue
+		}
+		if err := mng.leaveGuild(&discordgo.Guild{ID: config.GuildID, Name: "unknown"}); err != nil {
+			mng.logger.Error("Failed to leave guild", "guild", config.GuildID, "error", err)
+			continue
+		}
+		left++
+	}
+	// create the guild managers of guilds that were joined
+	for _, id := range guildIds {
+		if mng.GuildExists(id) {
+			continue
+		}
+		guild, err := mng.session.State.Guild(id)
+		if err != nil || guild.Unavailable {
+			continue
+		}
+		mng.onGuildJoin(&discordgo.GuildCreate{Guild: guild})
+		if mng.GuildExists(id) {
+			created++
+		}
+	}
+	if created != 0 || left != 0 {
+		mng.logger.Info(fmt.Sprintf("Reconciled guilds, joined %d and left %d", created, left))
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package fuse
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/utils"
+)
+
+const (
+	// DefaultGuildLoadConcurrency is the number of guild managers started at the same time when none is configured
+	DefaultGuildLoadConcurrency = 4
+	// guildLoadProgressSteps is the number of times the progress of loading guilds is logged
+	guildLoadProgressSteps = 10
+)
+
+// loadGuilds creates the guild managers of every stored guild and starts them in parallel
+// Guild create events are handled while the guilds load, so the stored guilds are read and their guild managers created
+// under reconcileMutex, skipping those an event has already created a guild manager for
+func (mng *Manager) loadGuilds() error {
+	mng.reconcileMutex.Lock()
+	// ensure we create the built-in tables before loading guilds
+	mng.connection.AutoMigrate(&GuildConfiguration{}, &ComponentState{}, &AuditEntry{})
+	// load guilds from database
+	var guilds []*GuildConfiguration
+	if err := mng.connection.Where("left_at IS NULL").Find(&guilds).Error; err != nil {
+		mng.reconcileMutex.Unlock()
+		return err
+	}
+
+	// create guild managers
+	guildManagers := make([]*GuildManager, 0, len(guilds))
+	for _, guild := range guilds {
+		// guilds of other shards are loaded by the processes running them
+		if mng.GuildExists(guild.GuildID) || !mng.ownsGuild(guild.GuildID) {
+			continue
+		}
+		guildManager, err := mng.createGuildManager(guild)
+		if err != nil {
+			mng.logger.Error("Failed to create guild manager", "guild", guild.GuildID, "error", err)
+			continue
+		}
+		guildManagers = append(guildManagers, guildManager)
+	}
+	mng.reconcileMutex.Unlock()
+
+	// start guild managers, each of which registers its commands through multiple REST calls
+	concurrency := mng.config.GuildLoadConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultGuildLoadConcurrency
+	}
+	total := len(guildManagers)
+	step := max(total/guildLoadProgressSteps, 1)
+	start := time.Now()
+	var started atomic.Int64
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, concurrency)
+	for _, guildManager := range guildManagers {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(guildManager *GuildManager) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			if err := guildManager.Start(); err != nil {
+				mng.logger.Error("Failed to start guild manager", "guild", guildManager.guild.ID, "error", err)
+			}
+			if done := started.Add(1); done%int64(step) == 0 && done != int64(total) {
+				mng.logger.Info(fmt.Sprintf("Started %d of %d guilds", done, total))
+			}
+		}(guildManager)
+	}
+	wg.Wait()
+
+	count := len(mng.GuildManagers())
+	mng.logger.Info(fmt.Sprintf("Loaded %d %s in %s", count, utils.Pluralize(count, "guild", "guilds"), time.Since(start).Round(time.Millisecond)))
+	return nil
+}
+
+// respondIfLoading answers interactions received for guilds whose guild manager has not been started yet
+// This applies while the manager is starting as well as to guilds joined or restored later, as their handlers are registered by Start
+// It returns whether the interaction has been answered
+func (mng *Manager) respondIfLoading(event *discordgo.InteractionCreate) bool {
+	if event.GuildID == "" {
+		return false
+	}
+	if guildManager, err := mng.GuildManager(event.GuildID); err == nil && guildManager.Started() {
+		return false
+	}
+	err := mng.session.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags:  discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{utils.InfoAsEmbed("The bot is still starting up in this server, please try again in a moment.")},
+		},
+	})
+	if err != nil {
+		mng.logger.Error("Failed to respond to interaction", "guild", event.GuildID, "error", err)
+	}
+	return true
+}
+
+// Started returns whether the guild manager has started its services and registered its handlers
+func (mng *GuildManager) Started() bool {
+	return mng.started.Load()
+}
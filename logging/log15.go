@@ -0,0 +1,32 @@
+package logging
+
+import log "github.com/inconshreveable/log15"
+
+type log15Logger struct {
+	logger log.Logger
+}
+
+// FromLog15 adapts a log15 logger to the fuse logging interface
+func FromLog15(logger log.Logger) Logger {
+	return &log15Logger{logger: logger}
+}
+
+func (l *log15Logger) Debug(msg string, ctx ...any) {
+	l.logger.Debug(msg, ctx...)
+}
+
+func (l *log15Logger) Info(msg string, ctx ...any) {
+	l.logger.Info(msg, ctx...)
+}
+
+func (l *log15Logger) Warn(msg string, ctx ...any) {
+	l.logger.Warn(msg, ctx...)
+}
+
+func (l *log15Logger) Error(msg string, ctx ...any) {
+	l.logger.Error(msg, ctx...)
+}
+
+func (l *log15Logger) With(ctx ...any) Logger {
+	return &log15Logger{logger: l.logger.New(ctx...)}
+}
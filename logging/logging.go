@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Logger is the logging interface used throughout fuse
+// Context is passed as alternating keys and values, e.g. logger.Info("Joined guild", "guild", id)
+type Logger interface {
+	Debug(msg string, ctx ...any)
+	Info(msg string, ctx ...any)
+	Warn(msg string, ctx ...any)
+	Error(msg string, ctx ...any)
+	// With returns a logger that adds the context to every record
+	With(ctx ...any) Logger
+}
+
+// Tee is a logger that also sends its records to a handler that can be replaced at any time
+// Loggers created with With share the handler of the logger they were created from
+type Tee struct {
+	base   Logger
+	shared *teeHandler
+	ctx    []any
+}
+
+type teeHandler struct {
+	mutex   sync.RWMutex
+	handler slog.Handler
+}
+
+// NewTee creates a logger that logs to base and, once set, the handler
+func NewTee(base Logger) *Tee {
+	return &Tee{base: base, shared: &teeHandler{}}
+}
+
+// SetHandler replaces the handler records are also sent to, a nil handler only logs to the base logger
+func (t *Tee) SetHandler(handler slog.Handler) {
+	t.shared.mutex.Lock()
+	defer t.shared.mutex.Unlock()
+	t.shared.handler = handler
+}
+
+func (t *Tee) Debug(msg string, ctx ...any) {
+	t.base.Debug(msg, ctx...)
+	t.handle(slog.LevelDebug, msg, ctx)
+}
+
+func (t *Tee) Info(msg string, ctx ...any) {
+	t.base.Info(msg, ctx...)
+	t.handle(slog.LevelInfo, msg, ctx)
+}
+
+func (t *Tee) Warn(msg string, ctx ...any) {
+	t.base.Warn(msg, ctx...)
+	t.handle(slog.LevelWarn, msg, ctx)
+}
+
+func (t *Tee) Error(msg string, ctx ...any) {
+	t.base.Error(msg, ctx...)
+	t.handle(slog.LevelError, msg, ctx)
+}
+
+func (t *Tee) With(ctx ...any) Logger {
+	return &Tee{
+		base:   t.base.With(ctx...),
+		shared: t.shared,
+		ctx:    append(append([]any(nil), t.ctx...), ctx...),
+	}
+}
+
+// handle sends the record to the handler if one is set and it accepts the level
+func (t *Tee) handle(level slog.Level, msg string, ctx []any) {
+	t.shared.mutex.RLock()
+	handler := t.shared.handler
+	t.shared.mutex.RUnlock()
+	if handler == nil || !handler.Enabled(context.Background(), level) {
+		return
+	}
+	record := slog.NewRecord(time.Now(), level, msg, 0)
+	record.Add(t.ctx...)
+	record.Add(ctx...)
+	_ = handler.Handle(context.Background(), record)
+}
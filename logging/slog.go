@@ -0,0 +1,36 @@
+package logging
+
+import "log/slog"
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// FromSlog adapts a slog logger to the fuse logging interface
+// If logger is nil, slog.Default() is used
+func FromSlog(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Debug(msg string, ctx ...any) {
+	l.logger.Debug(msg, ctx...)
+}
+
+func (l *slogLogger) Info(msg string, ctx ...any) {
+	l.logger.Info(msg, ctx...)
+}
+
+func (l *slogLogger) Warn(msg string, ctx ...any) {
+	l.logger.Warn(msg, ctx...)
+}
+
+func (l *slogLogger) Error(msg string, ctx ...any) {
+	l.logger.Error(msg, ctx...)
+}
+
+func (l *slogLogger) With(ctx ...any) Logger {
+	return &slogLogger{logger: l.logger.With(ctx...)}
+}
@@ -1,11 +1,20 @@
 package fuse
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"reflect"
-
-	log "github.com/inconshreveable/log15"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sylvrs/fuse/logging"
+	"github.com/sylvrs/fuse/metrics"
+	"github.com/sylvrs/fuse/modal"
+	"github.com/sylvrs/fuse/notify"
+	"github.com/sylvrs/fuse/tracing"
 	"github.com/sylvrs/fuse/utils"
 	"gorm.io/gorm"
 	gorm_logger "gorm.io/gorm/logger"
@@ -18,6 +27,34 @@ import (
 type Config struct {
 	// The token used to authenticate with Discord
 	Token string
+	// ConfigWriteBehind is the interval at which cached service configuration changes are written to the database
+	// If zero, changes are written immediately when saved
+	ConfigWriteBehind time.Duration
+	// ChangeBus is used to notify other processes sharing the database about configuration changes
+	// If nil, an in-process bus is used
+	ChangeBus notify.Bus
+	// GuildRetention is how long the data of a guild is kept after the bot leaves it
+	// If zero, DefaultGuildRetention is used. If negative, the data is purged immediately
+	GuildRetention time.Duration
+	// AuditRetention is how long audit entries are kept
+	// If zero, DefaultAuditRetention is used. If negative, entries are kept forever
+	AuditRetention time.Duration
+	// HTTPAddress is the address of the local HTTP server, e.g. 127.0.0.1:9090
+	// It exposes metrics at /metrics, health checks at /healthz and /readyz and a JSON status page at /status
+	// If empty, no server is started
+	HTTPAddress string
+	// GuildLoadConcurrency is the number of guild managers started at the same time when the manager starts
+	// If zero, DefaultGuildLoadConcurrency is used. Services must be safe to start for different guilds concurrently
+	GuildLoadConcurrency int
+	// DisconnectThreshold is how long the gateway may be disconnected before /healthz reports the manager as unhealthy
+	// If zero, DefaultDisconnectThreshold is used
+	DisconnectThreshold time.Duration
+	// Metrics is the registry the manager's metrics are recorded in
+	// If nil, a new registry is created
+	Metrics *metrics.Registry
+	// Tracer records a span for every handled interaction along with the database and REST calls made with its context
+	// If nil, nothing is traced
+	Tracer *tracing.Tracer
 }
 
 type ManagerStartFunc func(*Manager) error
@@ -25,16 +62,51 @@ type ManagerStartFunc func(*Manager) error
 // Manager is the overarching structure that manages all of the guild sub-services
 // Moreover, it holds the database connection and handles all Discord events
 type Manager struct {
-	logger        log.Logger
+	logger        logging.Logger
 	config        *Config
 	connection    *gorm.DB
 	session       *discordgo.Session
+	guildsMutex   sync.RWMutex
 	guildManagers map[string]*GuildManager
 	onStartFuncs  []ManagerStartFunc
-	services      []Service
+	services      []ContextService
+	// configTypes holds every service configuration type fetched through a guild manager
+	configTypesMutex sync.Mutex
+	configTypes      []reflect.Type
+	// origin is a random ID used to recognize change events published by this manager
+	origin       string
+	bus          notify.Bus
+	unsubscribe  func()
+	cleanupHooks []cleanupHook
+	purgeStop    chan struct{}
+	// modalHandler handles modals sent in response to interactions outside of guilds
+	modalHandler *modal.ModalHandler
+	registry     *metrics.Registry
+	metrics      *managerMetrics
+	httpServer   *http.Server
+	tracer       *tracing.Tracer
+	// ctx is cancelled when the manager stops
+	ctx    context.Context
+	cancel context.CancelFunc
+	// ready is set once the manager has started and cleared when it stops
+	ready             atomic.Bool
+	gatewayMutex      sync.Mutex
+	gatewayConnected  bool
+	disconnectedSince time.Time
+	hooksMutex        sync.Mutex
+	hooks             lifecycleHooks
+	// reconcileMutex prevents guild create events and reconciliation from creating the same guild manager twice
+	reconcileMutex sync.Mutex
+	// interactionContexts holds the contexts of the interactions being handled, keyed by interaction ID
+	interactionContexts sync.Map
 }
 
-func NewManager(dialector gorm.Dialector, logger log.Logger, config *Config) (*Manager, error) {
+// NewManager creates the manager, connecting to the database and creating the Discord session
+// Use logging.FromSlog or logging.FromLog15 to pass an existing logger. If logger is nil, slog.Default() is used
+func NewManager(dialector gorm.Dialector, logger logging.Logger, config *Config) (*Manager, error) {
+	if logger == nil {
+		logger = logging.FromSlog(nil)
+	}
 	// initialize database
 	database, err := gorm.Open(dialector, &gorm.Config{
 		Logger: gorm_logger.Default.LogMode(gorm_logger.Silent),
@@ -44,6 +116,11 @@ func NewManager(dialector gorm.Dialector, logger log.Logger, config *Config) (*M
 	if err != nil {
 		return nil, err
 	}
+	if config.Tracer != nil {
+		if err := registerTracingCallbacks(database); err != nil {
+			return nil, err
+		}
+	}
 	// create discord session
 	session, err := discordgo.New("Bot " + config.Token)
 	if err != nil {
@@ -51,15 +128,48 @@ func NewManager(dialector gorm.Dialector, logger log.Logger, config *Config) (*M
 	}
 	session.Identify.Intents = discordgo.MakeIntent(discordgo.IntentsAll)
 
-	return &Manager{
-		logger:        logger,
-		config:        config,
-		connection:    database,
-		guildManagers: make(map[string]*GuildManager),
-		session:       session,
-		onStartFuncs:  make([]ManagerStartFunc, 0),
-		services:      make([]Service, 0),
-	}, nil
+	bus := config.ChangeBus
+	if bus == nil {
+		bus = notify.NewLocalBus()
+	}
+
+	registry := config.Metrics
+	if registry == nil {
+		registry = metrics.NewRegistry()
+	}
+	managerMetrics := newManagerMetrics(registry)
+	// record every REST request and gateway event, including the ones made before the manager starts
+	transport := session.Client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	session.Client.Transport = &restTransport{base: transport, metrics: managerMetrics}
+	session.AddHandler(managerMetrics.onGatewayEvent)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mng := &Manager{
+		logger:            logger,
+		modalHandler:      modal.NewModalHandler(session, nil),
+		config:            config,
+		connection:        database,
+		guildManagers:     make(map[string]*GuildManager),
+		session:           session,
+		onStartFuncs:      make([]ManagerStartFunc, 0),
+		services:          make([]ContextService, 0),
+		origin:            utils.RandomId(8),
+		bus:               bus,
+		registry:          registry,
+		metrics:           managerMetrics,
+		tracer:            config.Tracer,
+		ctx:               ctx,
+		cancel:            cancel,
+		disconnectedSince: time.Now(),
+	}
+	session.AddHandler(mng.onConnect)
+	session.AddHandler(mng.onDisconnect)
+	session.AddHandler(mng.onResumed)
+	session.AddHandler(mng.onReady)
+	return mng, nil
 }
 
 func (mng *Manager) OnStart(f ManagerStartFunc) {
@@ -70,17 +180,64 @@ func (mng *Manager) OnStart(f ManagerStartFunc) {
 // In most cases, an empty struct should be passed in as the argument
 // This is because the actual guild services will be created using service.Create()
 func (mng *Manager) RegisterService(s Service) {
+	mng.RegisterContextService(AdaptService(s))
+}
+
+// RegisterContextService registers a context-aware service to be created when the manager starts
+func (mng *Manager) RegisterContextService(s ContextService) {
 	mng.services = append(mng.services, s)
-	mng.logger.Info(fmt.Sprintf("Registered service '%s'", reflect.TypeOf(s).Elem().Name()))
+	name := serviceName(s)
+	if cleaner, ok := unwrapService(s).(ServiceCleaner); ok {
+		mng.RegisterCleanup(name, cleaner.Cleanup)
+	}
+	if configured, ok := unwrapService(s).(ConfiguredService); ok {
+		if err := mng.RegisterConfigs(configured.Configs()...); err != nil {
+			mng.logger.Error("Failed to register service configurations", "service", name, "error", err)
+		}
+	}
+	mng.logger.Info(fmt.Sprintf("Registered service '%s'", name))
+}
+
+// RegisterConfigs registers service configuration types so that they can be used by the built-in commands
+// Types are also registered when they are first fetched, but registering them up front makes them available right after a restart
+func (mng *Manager) RegisterConfigs(configs ...interface{}) error {
+	for _, config := range configs {
+		value, err := configValue(config)
+		if err != nil {
+			return err
+		}
+		mng.registerConfigType(value.Type())
+	}
+	return nil
+}
+
+// registerConfigType records a service configuration type so that it can be used by the built-in commands
+func (mng *Manager) registerConfigType(t reflect.Type) {
+	mng.configTypesMutex.Lock()
+	defer mng.configTypesMutex.Unlock()
+	for _, existing := range mng.configTypes {
+		if existing == t {
+			return
+		}
+	}
+	mng.configTypes = append(mng.configTypes, t)
+}
+
+// ConfigTypes returns every service configuration type that has been registered or fetched through a guild manager
+func (mng *Manager) ConfigTypes() []reflect.Type {
+	mng.configTypesMutex.Lock()
+	defer mng.configTypesMutex.Unlock()
+	return append([]reflect.Type(nil), mng.configTypes...)
 }
 
 // CreateServices creates a service for a provided guild manager
-func (mng *Manager) CreateServices(guildManager *GuildManager) ([]Service, error) {
-	services := make([]Service, len(mng.services))
+func (mng *Manager) CreateServices(guildManager *GuildManager) ([]ContextService, error) {
+	services := make([]ContextService, len(mng.services))
 	for i, s := range mng.services {
 		service, err := s.Create(guildManager)
 		if err != nil {
-			mng.logger.Error("Failed to create service", "service", reflect.TypeOf(s).Name(), "error", err)
+			mng.logger.Error("Failed to create service", "service", serviceName(s), "error", err)
+			mng.metrics.serviceStartFailures.With(serviceName(s)).Inc()
 			return nil, err
 		}
 		services[i] = service
@@ -100,14 +257,18 @@ func (mng *Manager) Start() error {
 	if err := mng.session.Open(); err != nil {
 		return err
 	}
-
-	// load guilds before doing anything else
-	if err := mng.loadGuilds(); err != nil {
+	if err := mng.startHTTPServer(); err != nil {
 		return err
 	}
 
-	// create handlers
+	// register handlers first so that interactions received while loading are answered
 	mng.setupHandlers()
+	if err := mng.loadGuilds(); err != nil {
+		return err
+	}
+	mng.unsubscribe = mng.bus.Subscribe(mng.onChange)
+	mng.startGuildPurger()
+	mng.modalHandler.Start()
 
 	// run start functions
 	for _, f := range mng.onStartFuncs {
@@ -116,6 +277,7 @@ func (mng *Manager) Start() error {
 		}
 	}
 
+	mng.ready.Store(true)
 	mng.logger.Info(fmt.Sprintf("Logged in as %s#%s", mng.session.State.User.Username, mng.session.State.User.Discriminator))
 	return nil
 }
@@ -126,13 +288,12 @@ func (mng *Manager) onGuildLoad(event *discordgo.GuildCreate) {
 
 func (mng *Manager) onGuildJoin(event *discordgo.GuildCreate) {
 	mng.Logger().Info("Joined guild", "guild", event.ID)
-	guild := GuildConfiguration{
-		GuildID: event.ID,
-	}
-	mng.connection.Limit(1).Find(&guild)
-	// if guild already exists, don't do anything
-	if mng.connection.RowsAffected != 0 {
-		mng.Logger().Info("Guild already exists in database", "guild", event.ID)
+	var guild GuildConfiguration
+	// if guild already exists, restore it instead of creating a new one
+	if mng.connection.Where("guild_id = ?", event.ID).Limit(1).Find(&guild).RowsAffected != 0 {
+		if _, err := mng.restoreGuild(&guild); err != nil {
+			mng.Logger().Error("Failed to restore guild", "guild", event.ID, "error", err)
+		}
 		return
 	}
 
@@ -143,25 +304,34 @@ func (mng *Manager) onGuildJoin(event *discordgo.GuildCreate) {
 }
 
 func (mng *Manager) onGuildLeave(event *discordgo.GuildDelete) {
+	// guilds become unavailable during outages, in which case we have not actually left them
+	if event.Unavailable {
+		mng.Logger().Warn("Guild became unavailable", "guild", event.ID)
+		return
+	}
 	var guildConfig GuildConfiguration
 	if mng.Connection().Where("guild_id = ?", event.Guild.ID).Find(&guildConfig).RowsAffected == 0 {
 		mng.Logger().Error("Received guild deletion event but no associated guild found in database", "guild", event.Guild)
 		return
 	}
-	if err := mng.deleteGuild(event.Guild); err != nil {
-		mng.Logger().Error("Failed to delete guild", "guild", event.ID, "error", err)
+	if err := mng.leaveGuild(event.Guild); err != nil {
+		mng.Logger().Error("Failed to leave guild", "guild", event.ID, "error", err)
 	}
 	mng.Logger().Info("Left guild", "guild", event.ID)
 }
 
 func (mng *Manager) onReceiveCommand(event *discordgo.InteractionCreate) {
-	guildManager, ok := mng.guildManagers[event.GuildID]
-	if !ok {
+	guildManager, err := mng.GuildManager(event.GuildID)
+	if err != nil {
 		mng.logger.Error("Failed to find guild manager for guild", "guild", event.GuildID)
 		return
 	}
 	mng.logger.Debug(fmt.Sprintf("Received command for guild %s", guildManager.Guild().Name), "command", event.ApplicationCommandData().Name)
-	res, err := guildManager.commandHandler.Handle(mng.session, event)
+	ctx, finish := mng.startInteraction(guildManager, "command", event.ApplicationCommandData().Name, event)
+	start := time.Now()
+	res, err := guildManager.commandHandler.HandleContext(ctx, mng.session, event)
+	mng.metrics.observeInteraction("command", event.ApplicationCommandData().Name, start, err)
+	defer finish(err)
 	if err != nil {
 		mng.logger.Error("Failed to handle command", "command", event.ApplicationCommandData().Name, "error", err)
 		mng.session.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
@@ -172,26 +342,38 @@ func (mng *Manager) onReceiveCommand(event *discordgo.InteractionCreate) {
 					utils.ErrorAsEmbed(err.Error()),
 				},
 			},
-		})
+		}, discordgo.WithContext(ctx))
 		return
 	}
 	// if response is nil, don't respond
 	if res == nil {
 		return
 	}
-	if err = mng.session.InteractionRespond(event.Interaction, res); err != nil {
+	if err := mng.session.InteractionRespond(event.Interaction, res, discordgo.WithContext(ctx)); err != nil {
 		mng.logger.Error("Failed to respond to interaction", "error", err)
 	}
 }
 
 func (mng *Manager) onReceiveModal(event *discordgo.InteractionCreate) {
-	guildManager, ok := mng.guildManagers[event.GuildID]
-	if !ok {
-		mng.logger.Error("Failed to find guild manager for guild", "guild", event.GuildID)
-		return
+	modalHandler := mng.modalHandler
+	var guildManager *GuildManager
+	name := otherInteractionName
+	// modals submitted in DMs are handled by the manager itself
+	if event.GuildID != "" {
+		var err error
+		if guildManager, err = mng.GuildManager(event.GuildID); err != nil {
+			mng.logger.Error("Failed to find guild manager for guild", "guild", event.GuildID)
+			return
+		}
+		mng.logger.Debug(fmt.Sprintf("Received modal for guild %s", guildManager.Guild().Name), "modal", event.ModalSubmitData().CustomID)
+		modalHandler = guildManager.modalHandler
+		name = guildManager.interactionName(modalName(event.ModalSubmitData().CustomID))
 	}
-	mng.logger.Debug(fmt.Sprintf("Received modal for guild %s", guildManager.Guild().Name), "modal", event.ModalSubmitData().CustomID)
-	res, err := guildManager.modalHandler.Handle(event)
+	ctx, finish := mng.startInteraction(guildManager, "modal", name, event)
+	start := time.Now()
+	res, err := modalHandler.HandleContext(ctx, event)
+	mng.metrics.observeInteraction("modal", name, start, err)
+	defer finish(err)
 	if err != nil {
 		mng.logger.Error("Failed to handle modal", "error", err)
 		mng.session.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
@@ -202,20 +384,22 @@ func (mng *Manager) onReceiveModal(event *discordgo.InteractionCreate) {
 					utils.ErrorAsEmbed(err.Error()),
 				},
 			},
-		})
+		}, discordgo.WithContext(ctx))
 		return
 	}
 	// if response is nil, don't respond
 	if res == nil {
 		return
 	}
-	if err = mng.session.InteractionRespond(event.Interaction, res); err != nil {
+	if err := mng.session.InteractionRespond(event.Interaction, res, discordgo.WithContext(ctx)); err != nil {
 		mng.logger.Error("Failed to respond to interaction", "error", err)
 	}
 }
 
 func (mng *Manager) setupHandlers() {
 	mng.session.AddHandler(func(s *discordgo.Session, event *discordgo.GuildCreate) {
+		mng.reconcileMutex.Lock()
+		defer mng.reconcileMutex.Unlock()
 		if mng.GuildExists(event.Guild.ID) {
 			mng.onGuildLoad(event)
 			return
@@ -224,6 +408,9 @@ func (mng *Manager) setupHandlers() {
 	})
 	mng.session.AddHandler(func(s *discordgo.Session, event *discordgo.GuildDelete) { mng.onGuildLeave(event) })
 	mng.session.AddHandler(func(s *discordgo.Session, event *discordgo.InteractionCreate) {
+		if mng.respondIfLoading(event) {
+			return
+		}
 		switch event.Type {
 		case discordgo.InteractionApplicationCommand:
 			mng.onReceiveCommand(event)
@@ -234,32 +421,6 @@ func (mng *Manager) setupHandlers() {
 	mng.logger.Info("Registered event handlers")
 }
 
-func (mng *Manager) loadGuilds() error {
-	// ensure we create the guild configuration table before loading guilds
-	mng.connection.AutoMigrate(&GuildConfiguration{})
-	// load guilds from database
-	var guilds []*GuildConfiguration
-	if err := mng.connection.Find(&guilds).Error; err != nil {
-		return err
-	}
-
-	// create guild managers
-	for _, guild := range guilds {
-		guildManager, err := mng.createGuildManager(guild)
-		if err != nil {
-			mng.logger.Error("Failed to create guild manager", "guild", guild.GuildID, "error", err)
-			continue
-		}
-
-		if err := guildManager.Start(); err != nil {
-			mng.logger.Error("Failed to start guild manager", "guild", guild.GuildID, "error", err)
-		}
-	}
-
-	mng.logger.Info(fmt.Sprintf("Loaded %d %s", len(mng.guildManagers), utils.Pluralize(len(mng.guildManagers), "guild", "guilds")))
-	return nil
-}
-
 // createGuildManager creates a guild manager for a provided guild configuration
 func (mng *Manager) createGuildManager(guild *GuildConfiguration) (*GuildManager, error) {
 	// create guild manager
@@ -268,7 +429,10 @@ func (mng *Manager) createGuildManager(guild *GuildConfiguration) (*GuildManager
 		return nil, err
 	}
 	// add guild manager to map
+	mng.guildsMutex.Lock()
 	mng.guildManagers[guild.GuildID] = guildManager
+	mng.metrics.guildsLoaded.Set(float64(len(mng.guildManagers)))
+	mng.guildsMutex.Unlock()
 	// setup guild manager
 	return guildManager, nil
 }
@@ -293,26 +457,60 @@ func (mng *Manager) createGuild(guild *discordgo.Guild) (*GuildManager, error) {
 	return guildManager, nil
 }
 
-func (mng *Manager) deleteGuild(guild *discordgo.Guild) error {
-	// delete guild from database
-	if err := mng.connection.Where("guild_id = ?", guild.ID).Delete(&GuildConfiguration{}).Error; err != nil {
+// restoreGuild creates a guild manager for a guild that already exists in the database
+// If the guild was marked as left, its data is kept and the mark is removed
+func (mng *Manager) restoreGuild(config *GuildConfiguration) (*GuildManager, error) {
+	if config.LeftAt != nil {
+		config.LeftAt = nil
+		if err := mng.connection.Model(config).Update("left_at", nil).Error; err != nil {
+			return nil, err
+		}
+		mng.logger.Info("Restored data for rejoined guild", "guild", config.GuildID)
+	}
+	guildManager, err := mng.createGuildManager(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := guildManager.Start(); err != nil {
+		return nil, err
+	}
+	return guildManager, nil
+}
+
+// leaveGuild stops the guild's manager and marks the guild as left
+// Its data is kept until the retention period has passed so that it can be restored if the bot rejoins
+func (mng *Manager) leaveGuild(guild *discordgo.Guild) error {
+	now := time.Now()
+	if err := mng.connection.Model(&GuildConfiguration{GuildID: guild.ID}).Update("left_at", &now).Error; err != nil {
 		return err
 	}
-	guildManager := mng.guildManagers[guild.ID]
-	// stop guild manager
-	guildManager.Stop()
+	mng.guildsMutex.Lock()
+	guildManager, ok := mng.guildManagers[guild.ID]
 	// delete guild manager from map
 	delete(mng.guildManagers, guild.ID)
-	mng.logger.Info(fmt.Sprintf("Deleted guild %s (id: %s)", guild.Name, guild.ID))
+	mng.metrics.guildsLoaded.Set(float64(len(mng.guildManagers)))
+	mng.guildsMutex.Unlock()
+	// stop guild manager
+	if ok {
+		guildManager.Stop()
+	}
+	mng.logger.Info(fmt.Sprintf("Marked guild %s (id: %s) as left", guild.Name, guild.ID))
+	if mng.retention() <= 0 {
+		return mng.purgeGuild(guild.ID)
+	}
 	return nil
 }
 
 func (mng *Manager) GuildExists(guildID string) bool {
+	mng.guildsMutex.RLock()
+	defer mng.guildsMutex.RUnlock()
 	_, ok := mng.guildManagers[guildID]
 	return ok
 }
 
 func (mng *Manager) GuildManager(guildID string) (*GuildManager, error) {
+	mng.guildsMutex.RLock()
+	defer mng.guildsMutex.RUnlock()
 	guildManager, ok := mng.guildManagers[guildID]
 	if !ok {
 		return nil, fmt.Errorf("guild manager not found for guild %s", guildID)
@@ -320,15 +518,38 @@ func (mng *Manager) GuildManager(guildID string) (*GuildManager, error) {
 	return guildManager, nil
 }
 
+// GuildManagers returns a snapshot of all currently loaded guild managers
+func (mng *Manager) GuildManagers() []*GuildManager {
+	mng.guildsMutex.RLock()
+	defer mng.guildsMutex.RUnlock()
+	guildManagers := make([]*GuildManager, 0, len(mng.guildManagers))
+	for _, guildManager := range mng.guildManagers {
+		guildManagers = append(guildManagers, guildManager)
+	}
+	return guildManagers
+}
+
 func (mng *Manager) Stop() {
+	mng.ready.Store(false)
+	// cancel the interactions being handled and the background work of services
+	mng.cancel()
+	if mng.unsubscribe != nil {
+		mng.unsubscribe()
+	}
+	mng.stopGuildPurger()
+	mng.modalHandler.Stop()
 	// handle stopping for guilds
-	for _, guildManager := range mng.guildManagers {
+	for _, guildManager := range mng.GuildManagers() {
 		guildManager.Stop()
 	}
+	mng.stopHTTPServer()
+	if err := mng.bus.Close(); err != nil {
+		mng.logger.Error("Failed to close change bus", "error", err)
+	}
 	mng.session.Close()
 }
 
-func (mng *Manager) Logger() log.Logger {
+func (mng *Manager) Logger() logging.Logger {
 	return mng.logger
 }
 
@@ -340,10 +561,26 @@ func (mng *Manager) Session() *discordgo.Session {
 	return mng.session
 }
 
+// ModalHandler returns the modal handler for interactions outside of guilds, e.g. in DMs
+// Modals sent in guilds should use the modal handler of their guild manager instead
+func (mng *Manager) ModalHandler() *modal.ModalHandler {
+	return mng.modalHandler
+}
+
+// Metrics returns the registry the manager's metrics are recorded in
+func (mng *Manager) Metrics() *metrics.Registry {
+	return mng.registry
+}
+
 func (mng *Manager) Connection() *gorm.DB {
 	return mng.connection
 }
 
+// ChangeBus returns the bus used to notify other processes about configuration changes
+func (mng *Manager) ChangeBus() notify.Bus {
+	return mng.bus
+}
+
 func (mng *Manager) BotUser() *discordgo.User {
 	return mng.session.State.User
 }
@@ -0,0 +1,143 @@
+package fuse
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/metrics"
+	"github.com/sylvrs/fuse/tracing"
+)
+
+const (
+	outcomeSuccess = "success"
+	outcomeError   = "error"
+	// otherInteractionName is the name recorded for custom IDs that do not match a route, as they may contain arbitrary data
+	otherInteractionName = "other"
+)
+
+// managerMetrics holds the metrics recorded by the manager and its guild managers
+type managerMetrics struct {
+	interactions         *metrics.CounterVec
+	interactionDuration  *metrics.HistogramVec
+	gatewayEvents        *metrics.CounterVec
+	restRequests         *metrics.CounterVec
+	restDuration         *metrics.HistogramVec
+	restRateLimited      *metrics.CounterVec
+	guildsLoaded         *metrics.Gauge
+	serviceStartFailures *metrics.CounterVec
+}
+
+func newManagerMetrics(registry *metrics.Registry) *managerMetrics {
+	return &managerMetrics{
+		interactions:         registry.Counter("fuse_interactions_total", "Interactions handled, by type, name and outcome.", "type", "name", "outcome"),
+		interactionDuration:  registry.Histogram("fuse_interaction_duration_seconds", "Time taken to handle interactions, by type and name.", nil, "type", "name"),
+		gatewayEvents:        registry.Counter("fuse_gateway_events_total", "Gateway events received, by type.", "type"),
+		restRequests:         registry.Counter("fuse_discord_requests_total", "Discord REST requests, by method, route and status.", "method", "route", "status"),
+		restDuration:         registry.Histogram("fuse_discord_request_duration_seconds", "Time taken by Discord REST requests, by method and route.", nil, "method", "route"),
+		restRateLimited:      registry.Counter("fuse_discord_rate_limited_total", "Discord REST requests that were rate limited, by route and scope.", "route", "scope"),
+		guildsLoaded:         registry.Gauge("fuse_guilds_loaded", "Guilds with a running guild manager.").With(),
+		serviceStartFailures: registry.Counter("fuse_service_start_failures_total", "Services that failed to be created or started, by service.", "service"),
+	}
+}
+
+// observeInteraction records the outcome and latency of a handled interaction
+func (m *managerMetrics) observeInteraction(kind, name string, start time.Time, err error) {
+	outcome := outcomeSuccess
+	if err != nil {
+		outcome = outcomeError
+	}
+	m.interactions.With(kind, name, outcome).Inc()
+	m.interactionDuration.With(kind, name).Observe(time.Since(start).Seconds())
+}
+
+// onGatewayEvent counts every event received from the gateway
+func (m *managerMetrics) onGatewayEvent(_ *discordgo.Session, event *discordgo.Event) {
+	m.gatewayEvents.With(event.Type).Inc()
+}
+
+// restTransport is an HTTP transport that records the Discord REST requests made through it
+type restTransport struct {
+	base    http.RoundTripper
+	metrics *managerMetrics
+}
+
+func (t *restTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	route := restRoute(request.URL.Path)
+	// requests made with discordgo.WithContext are traced as part of the context's span
+	_, span := tracing.Start(request.Context(), fmt.Sprintf("discord %s %s", request.Method, route), "http.method", request.Method, "http.route", route)
+	defer span.End()
+	start := time.Now()
+	response, err := t.base.RoundTrip(request)
+	t.metrics.restDuration.With(request.Method, route).Observe(time.Since(start).Seconds())
+	if err != nil {
+		t.metrics.restRequests.With(request.Method, route, outcomeError).Inc()
+		span.RecordError(err)
+		return response, err
+	}
+	t.metrics.restRequests.With(request.Method, route, strconv.Itoa(response.StatusCode)).Inc()
+	span.SetAttributes("http.status_code", response.StatusCode)
+	if response.StatusCode >= http.StatusBadRequest {
+		span.RecordError(fmt.Errorf("discord responded with status %d", response.StatusCode))
+	}
+	if response.StatusCode == http.StatusTooManyRequests {
+		scope := response.Header.Get("X-RateLimit-Scope")
+		if scope == "" {
+			scope = "unknown"
+		}
+		t.metrics.restRateLimited.With(route, scope).Inc()
+	}
+	return response, nil
+}
+
+// restRoute turns the path of a Discord REST request into a route with bounded cardinality
+// IDs, interaction and webhook tokens and emojis are replaced with placeholders
+func restRoute(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) >= 2 && segments[0] == "api" && strings.HasPrefix(segments[1], "v") {
+		segments = segments[2:]
+	}
+	for i, segment := range segments {
+		switch {
+		case isSnowflake(segment):
+			segments[i] = ":id"
+		case i > 1 && (segments[i-2] == "webhooks" || segments[i-2] == "interactions"):
+			segments[i] = ":token"
+		case i > 0 && segments[i-1] == "reactions":
+			segments[i] = ":emoji"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func isSnowflake(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	for _, r := range segment {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// interactionName returns the name used to record metrics for a component or modal custom ID
+// Custom IDs matching a route are recorded by pattern as they usually contain IDs, every other one is recorded as otherInteractionName
+func (mng *GuildManager) interactionName(customId string) string {
+	if route, _, _, ok := mng.componentRouter.Lookup(customId); ok {
+		return route.Pattern()
+	}
+	return otherInteractionName
+}
+
+// modalName returns the ID of the modal a submitted custom ID belongs to by removing its unique suffix
+func modalName(customId string) string {
+	if index := strings.LastIndex(customId, "-"); index != -1 {
+		return customId[:index]
+	}
+	return customId
+}
@@ -0,0 +1,227 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets used when none are provided, suited for latencies in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// Registry holds a set of metrics and writes them in the Prometheus text format
+type Registry struct {
+	mutex    sync.Mutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// family is a metric along with every combination of label values it has been used with
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	mutex   sync.Mutex
+	series  map[string]*series
+}
+
+// series is the value of a metric for a single combination of label values
+type series struct {
+	labels []string
+	mutex  sync.Mutex
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// register returns the family with the name, creating it if it does not exist yet
+// It panics if the name is invalid or already used by a metric of another kind or with other labels
+func (r *Registry) register(name, help, kind string, labels []string, buckets []float64) *family {
+	if !namePattern.MatchString(name) {
+		panic(fmt.Errorf("invalid metric name '%s'", name))
+	}
+	for _, label := range labels {
+		if !namePattern.MatchString(label) || strings.Contains(label, ":") || label == "le" {
+			panic(fmt.Errorf("invalid label name '%s' for metric '%s'", label, name))
+		}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if existing, ok := r.families[name]; ok {
+		if existing.kind != kind || strings.Join(existing.labels, ",") != strings.Join(labels, ",") {
+			panic(fmt.Errorf("metric '%s' is already registered as a %s with labels %v", name, existing.kind, existing.labels))
+		}
+		return existing
+	}
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.families[name] = f
+	return f
+}
+
+// with returns the series for the label values, creating it if it does not exist yet
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Errorf("metric '%s' expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		if f.kind == kindHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// CounterVec is a counter partitioned by label values
+type CounterVec struct {
+	family *family
+}
+
+// Counter registers a counter, or returns the existing counter with the same name
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{family: r.register(name, help, kindCounter, labels, nil)}
+}
+
+// With returns the counter for the label values, which must be given in the order of the labels
+func (v *CounterVec) With(values ...string) *Counter {
+	return &Counter{series: v.family.with(values)}
+}
+
+// Counter is a value that only ever increases
+type Counter struct {
+	series *series
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increases the counter by the value, negative values are ignored
+func (c *Counter) Add(value float64) {
+	if value < 0 {
+		return
+	}
+	c.series.mutex.Lock()
+	defer c.series.mutex.Unlock()
+	c.series.value += value
+}
+
+// GaugeVec is a gauge partitioned by label values
+type GaugeVec struct {
+	family *family
+}
+
+// Gauge registers a gauge, or returns the existing gauge with the same name
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{family: r.register(name, help, kindGauge, labels, nil)}
+}
+
+// With returns the gauge for the label values, which must be given in the order of the labels
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return &Gauge{series: v.family.with(values)}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	series *series
+}
+
+func (g *Gauge) Set(value float64) {
+	g.series.mutex.Lock()
+	defer g.series.mutex.Unlock()
+	g.series.value = value
+}
+
+func (g *Gauge) Add(value float64) {
+	g.series.mutex.Lock()
+	defer g.series.mutex.Unlock()
+	g.series.value += value
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	family *family
+}
+
+// Histogram registers a histogram, or returns the existing histogram with the same name
+// If no buckets are given, DefaultBuckets is used
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{family: r.register(name, help, kindHistogram, labels, buckets)}
+}
+
+// With returns the histogram for the label values, which must be given in the order of the labels
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return &Histogram{series: v.family.with(values), buckets: v.family.buckets}
+}
+
+// Histogram counts observed values in buckets
+type Histogram struct {
+	series  *series
+	buckets []float64
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.series.mutex.Lock()
+	defer h.series.mutex.Unlock()
+	// values above the last bucket are only counted in the implicit +Inf bucket
+	if index := sort.SearchFloat64s(h.buckets, value); index < len(h.buckets) {
+		h.series.counts[index]++
+	}
+	h.series.sum += value
+	h.series.count++
+}
+
+// formatValue formats a sample value as expected by the Prometheus text format
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	// ContentType is the content type of the Prometheus text format
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// WriteText writes every metric of the registry in the Prometheus text format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mutex.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mutex.Unlock()
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	writer := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(writer)
+	}
+	return writer.Flush()
+}
+
+// Handler returns an HTTP handler serving the metrics of the registry in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteText(w)
+	})
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mutex.Lock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]*series, len(keys))
+	for i, key := range keys {
+		series[i] = f.series[key]
+	}
+	f.mutex.Unlock()
+
+	if f.help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, helpEscaper.Replace(f.help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+	for _, s := range series {
+		s.mutex.Lock()
+		if f.kind != kindHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.formatLabels(s.labels, ""), formatValue(s.value))
+			s.mutex.Unlock()
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.formatLabels(s.labels, formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.formatLabels(s.labels, formatValue(math.Inf(1))), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.formatLabels(s.labels, ""), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.formatLabels(s.labels, ""), s.count)
+		s.mutex.Unlock()
+	}
+}
+
+// formatLabels formats the label values of a series, adding the le label of histogram buckets if given
+func (f *family) formatLabels(values []string, le string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, value := range values {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, f.labels[i], labelEscaper.Replace(value)))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf(`le="%s"`, le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
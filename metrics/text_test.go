@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func writeText(t *testing.T, r *Registry) string {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := r.WriteText(&buffer); err != nil {
+		t.Fatalf("failed to write metrics: %v", err)
+	}
+	return buffer.String()
+}
+
+func TestWriteTextCounterAndGauge(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("requests_total", "Requests handled.", "method").With("GET").Add(3)
+	r.Gauge("in_flight", "").With().Set(-2.5)
+
+	expected := strings.Join([]string{
+		"# TYPE in_flight gauge",
+		"in_flight -2.5",
+		"# HELP requests_total Requests handled.",
+		"# TYPE requests_total counter",
+		`requests_total{method="GET"} 3`,
+		"",
+	}, "\n")
+	if got := writeText(t, r); got != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestWriteTextEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("escaped_total", "A help text with a \\ and a\nnew line.", "value").With("a \"quoted\" \\ value\non two lines").Inc()
+
+	output := writeText(t, r)
+	for _, line := range []string{
+		`# HELP escaped_total A help text with a \\ and a\nnew line.`,
+		`escaped_total{value="a \"quoted\" \\ value\non two lines"} 1`,
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("expected line %q in output:\n%s", line, output)
+		}
+	}
+}
+
+func TestWriteTextHistogram(t *testing.T) {
+	r := NewRegistry()
+	histogram := r.Histogram("latency_seconds", "Latency.", []float64{1, 0.5}, "route").With("/a")
+	for _, value := range []float64{0.1, 0.5, 0.7, 3} {
+		histogram.Observe(value)
+	}
+
+	expected := strings.Join([]string{
+		"# HELP latency_seconds Latency.",
+		"# TYPE latency_seconds histogram",
+		`latency_seconds_bucket{route="/a",le="0.5"} 2`,
+		`latency_seconds_bucket{route="/a",le="1"} 3`,
+		`latency_seconds_bucket{route="/a",le="+Inf"} 4`,
+		`latency_seconds_sum{route="/a"} 4.3`,
+		`latency_seconds_count{route="/a"} 4`,
+		"",
+	}, "\n")
+	if got := writeText(t, r); got != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestWriteTextHistogramWithoutLabels(t *testing.T) {
+	r := NewRegistry()
+	r.Histogram("sizes", "", []float64{10}).With().Observe(20)
+
+	expected := strings.Join([]string{
+		"# TYPE sizes histogram",
+		`sizes_bucket{le="10"} 0`,
+		`sizes_bucket{le="+Inf"} 1`,
+		"sizes_sum 20",
+		"sizes_count 1",
+		"",
+	}, "\n")
+	if got := writeText(t, r); got != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestRegisterInvalidLabel(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering a histogram with an le label to panic")
+		}
+	}()
+	NewRegistry().Histogram("invalid", "", nil, "le")
+}
@@ -0,0 +1,25 @@
+package fuse
+
+import "testing"
+
+func TestRestRoute(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/api/v9/gateway/bot", "/gateway/bot"},
+		{"/api/v9/channels/123456789012345678/messages", "/channels/:id/messages"},
+		{"/api/v9/channels/123456789012345678/messages/876543210987654321", "/channels/:id/messages/:id"},
+		{"/api/v9/channels/123/messages/456/reactions/%F0%9F%91%8D/@me", "/channels/:id/messages/:id/reactions/:emoji/@me"},
+		{"/api/v9/channels/123/messages/456/reactions/name:789", "/channels/:id/messages/:id/reactions/:emoji"},
+		{"/api/v9/interactions/123/aW50ZXJhY3Rpb24tdG9rZW4/callback", "/interactions/:id/:token/callback"},
+		{"/api/v9/webhooks/123/d2ViaG9vay10b2tlbg/messages/@original", "/webhooks/:id/:token/messages/@original"},
+		{"/api/v9/applications/123/guilds/456/commands", "/applications/:id/guilds/:id/commands"},
+		{"/users/@me", "/users/@me"},
+	}
+	for _, test := range tests {
+		if got := restRoute(test.path); got != test.expected {
+			t.Errorf("restRoute(%q) = %q, expected %q", test.path, got, test.expected)
+		}
+	}
+}
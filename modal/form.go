@@ -0,0 +1,260 @@
+package modal
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/utils"
+)
+
+const (
+	// formTag is the struct tag used to describe a form field
+	// It uses the same format as gorm, e.g. `modal:"label:Your name;style:paragraph;min_length:2;max_length:100;required"`
+	formTag = "modal"
+	// maxFormFields is the maximum number of text inputs Discord allows in a modal
+	maxFormFields = 5
+	// maxLabelLength is the maximum length of a text input label allowed by Discord
+	maxLabelLength = 45
+)
+
+// FormHandlerFunc handles a submitted form once it has passed validation
+type FormHandlerFunc[T any] func(s *discordgo.Session, i *discordgo.InteractionCreate, form *T) (*discordgo.InteractionResponse, error)
+
+// FieldError is a validation error for a single field of a form
+type FieldError struct {
+	// Label is the label of the field as shown in the modal
+	Label string
+	// Message describes what is wrong with the value
+	Message string
+}
+
+// FieldErrors is the list of validation errors of a submitted form
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	messages := utils.Map(e, func(err FieldError) string { return fmt.Sprintf("%s %s", err.Label, err.Message) })
+	return strings.Join(messages, ", ")
+}
+
+// Embed returns an embed listing every field error
+func (e FieldErrors) Embed() *discordgo.MessageEmbed {
+	embed := utils.ErrorAsEmbed("Please correct the following fields and try again.")
+	for _, err := range e {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: err.Label, Value: err.Message})
+	}
+	return embed
+}
+
+// formField is a single text input of a form
+type formField struct {
+	index       int
+	id          string
+	label       string
+	style       discordgo.TextInputStyle
+	placeholder string
+	required    bool
+	minLength   int
+	maxLength   int
+	pattern     *regexp.Regexp
+}
+
+// parseForm reads the fields of a form struct
+func parseForm(t reflect.Type) ([]*formField, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("form must be a struct, got %s", t)
+	}
+	fields := make([]*formField, 0)
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		tag := structField.Tag.Get(formTag)
+		if !structField.IsExported() || tag == "-" {
+			continue
+		}
+		switch structField.Type.Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		default:
+			return nil, fmt.Errorf("unsupported type %s for form field %s", structField.Type, structField.Name)
+		}
+
+		options := utils.ParseTag(tag)
+		field := &formField{
+			index: i,
+			id:    utils.IfElse(options["id"] == "", utils.SnakeCase(structField.Name), options["id"]),
+			label: utils.IfElse(options["label"] == "", utils.HumanCase(structField.Name), options["label"]),
+			style: discordgo.TextInputShort,
+		}
+		_, field.required = options["required"]
+		field.placeholder = options["placeholder"]
+		if options["style"] == "paragraph" {
+			field.style = discordgo.TextInputParagraph
+		}
+		var err error
+		if raw, ok := options["min_length"]; ok {
+			if field.minLength, err = strconv.Atoi(raw); err != nil {
+				return nil, fmt.Errorf("invalid min_length '%s' for form field %s", raw, structField.Name)
+			}
+		}
+		if raw, ok := options["max_length"]; ok {
+			if field.maxLength, err = strconv.Atoi(raw); err != nil {
+				return nil, fmt.Errorf("invalid max_length '%s' for form field %s", raw, structField.Name)
+			}
+		}
+		if raw, ok := options["pattern"]; ok {
+			if field.pattern, err = regexp.Compile(raw); err != nil {
+				return nil, fmt.Errorf("invalid pattern for form field %s: %w", structField.Name, err)
+			}
+		}
+		if len(field.label) > maxLabelLength {
+			return nil, fmt.Errorf("label of form field %s is longer than %d characters", structField.Name, maxLabelLength)
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 || len(fields) > maxFormFields {
+		return nil, fmt.Errorf("form must have between 1 and %d fields", maxFormFields)
+	}
+	return fields, nil
+}
+
+// input creates the text input for the field, prefilled with the given value
+func (f *formField) input(value reflect.Value) discordgo.TextInput {
+	input := discordgo.TextInput{
+		CustomID:    f.id,
+		Label:       f.label,
+		Style:       f.style,
+		Placeholder: f.placeholder,
+		Required:    f.required,
+		MinLength:   f.minLength,
+		MaxLength:   f.maxLength,
+	}
+	if value.IsValid() && !value.IsZero() {
+		input.Value = fmt.Sprintf("%v", value.Interface())
+	}
+	return input
+}
+
+// decode validates the submitted value and stores it in the field
+func (f *formField) decode(raw string, value reflect.Value) string {
+	length := len([]rune(raw))
+	switch {
+	case raw == "" && f.required:
+		return "is required"
+	case raw == "":
+		return ""
+	case f.minLength != 0 && length < f.minLength:
+		return fmt.Sprintf("must be at least %d characters long", f.minLength)
+	case f.maxLength != 0 && length > f.maxLength:
+		return fmt.Sprintf("must be at most %d characters long", f.maxLength)
+	case f.pattern != nil && !f.pattern.MatchString(raw):
+		return "has an invalid format"
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, err := strconv.ParseInt(strings.TrimSpace(raw), 10, value.Type().Bits())
+		if err != nil {
+			return "must be a whole number"
+		}
+		value.SetInt(number)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number, err := strconv.ParseUint(strings.TrimSpace(raw), 10, value.Type().Bits())
+		if err != nil {
+			return "must be a positive whole number"
+		}
+		value.SetUint(number)
+	case reflect.Float32, reflect.Float64:
+		number, err := strconv.ParseFloat(strings.TrimSpace(raw), value.Type().Bits())
+		if err != nil {
+			return "must be a number"
+		}
+		value.SetFloat(number)
+	}
+	return ""
+}
+
+// NewForm creates a modal whose text inputs are generated from the fields of T
+// If initial is not nil, the inputs are prefilled with its values
+// Once submitted, the values are decoded and validated before being passed to the handler
+// If validation fails, the user receives an ephemeral message listing the invalid fields and the modal stays pending so that it can be submitted again
+func NewForm[T any](id, title string, initial *T, handler FormHandlerFunc[T]) (*Modal, error) {
+	fields, err := parseForm(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	var initialValue reflect.Value
+	if initial != nil {
+		initialValue = reflect.ValueOf(initial).Elem()
+	}
+	inputs := utils.Map(fields, func(field *formField) discordgo.TextInput {
+		if !initialValue.IsValid() {
+			return field.input(reflect.Value{})
+		}
+		return field.input(initialValue.Field(field.index))
+	})
+	m := NewTextModal(id, title, inputs, nil)
+	m.ContextHandler = func(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+		form := new(T)
+		if err := DecodeForm(i, form); err != nil {
+			if fieldErrors, ok := err.(FieldErrors); ok {
+				// the form can be submitted again with corrected values
+				KeepPending(ctx)
+				return &discordgo.InteractionResponse{
+					Type: discordgo.InteractionResponseChannelMessageWithSource,
+					Data: &discordgo.InteractionResponseData{
+						Flags:  discordgo.MessageFlagsEphemeral,
+						Embeds: []*discordgo.MessageEmbed{fieldErrors.Embed()},
+					},
+				}, nil
+			}
+			return nil, err
+		}
+		return handler(s, i, form)
+	}
+	return m, nil
+}
+
+// DecodeForm decodes the text inputs of a submitted modal into the fields of form, which must be a pointer to a struct
+// If any value is invalid, FieldErrors is returned
+func DecodeForm(i *discordgo.InteractionCreate, form interface{}) error {
+	value := reflect.ValueOf(form)
+	if value.Kind() != reflect.Pointer {
+		return fmt.Errorf("form must be a pointer to a struct, got %T", form)
+	}
+	fields, err := parseForm(value.Elem().Type())
+	if err != nil {
+		return err
+	}
+	values := submittedValues(i.ModalSubmitData().Components)
+	fieldErrors := make(FieldErrors, 0)
+	for _, field := range fields {
+		if message := field.decode(values[field.id], value.Elem().Field(field.index)); message != "" {
+			fieldErrors = append(fieldErrors, FieldError{Label: field.label, Message: message})
+		}
+	}
+	if len(fieldErrors) != 0 {
+		return fieldErrors
+	}
+	return nil
+}
+
+// submittedValues returns the values of every text input of a submitted modal, keyed by their custom ID
+func submittedValues(components []discordgo.MessageComponent) map[string]string {
+	values := make(map[string]string)
+	for _, c := range components {
+		switch c := c.(type) {
+		case *discordgo.ActionsRow:
+			for key, value := range submittedValues(c.Components) {
+				values[key] = value
+			}
+		case *discordgo.TextInput:
+			values[c.CustomID] = c.Value
+		}
+	}
+	return values
+}
@@ -0,0 +1,161 @@
+package modal
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type testForm struct {
+	Name    string  `modal:"label:Your name;min_length:2;max_length:10;required"`
+	Age     int     `modal:"id:years"`
+	Count   uint8   `modal:""`
+	Score   float64 `modal:"placeholder:0.5"`
+	Code    string  `modal:"pattern:^[A-Z]{3}$"`
+	private string
+}
+
+// submission creates a submitted modal with a text input for every value, keyed by their custom ID
+func submission(values map[string]string) *discordgo.InteractionCreate {
+	components := make([]discordgo.MessageComponent, 0, len(values))
+	for id, value := range values {
+		components = append(components, &discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			&discordgo.TextInput{CustomID: id, Value: value},
+		}})
+	}
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type: discordgo.InteractionModalSubmit,
+		Data: discordgo.ModalSubmitInteractionData{CustomID: "form", Components: components},
+	}}
+}
+
+func TestDecodeForm(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   map[string]string
+		expected testForm
+		// errors maps the label of every invalid field to its message
+		errors map[string]string
+	}{
+		{
+			name:     "valid",
+			values:   map[string]string{"name": "Alice", "years": " 30 ", "count": "7", "score": "0.25", "code": "ABC"},
+			expected: testForm{Name: "Alice", Age: 30, Count: 7, Score: 0.25, Code: "ABC"},
+		},
+		{
+			name:     "optional fields left empty",
+			values:   map[string]string{"name": "Bob"},
+			expected: testForm{Name: "Bob"},
+		},
+		{
+			name:     "lengths are counted in characters",
+			values:   map[string]string{"name": "ééééééééé"},
+			expected: testForm{Name: "ééééééééé"},
+		},
+		{
+			name:   "missing required field",
+			values: map[string]string{"years": "1"},
+			errors: map[string]string{"Your name": "is required"},
+		},
+		{
+			name:   "too short and invalid format",
+			values: map[string]string{"name": "A", "code": "ABCD"},
+			errors: map[string]string{"Your name": "must be at least 2 characters long", "Code": "has an invalid format"},
+		},
+		{
+			name:   "too long",
+			values: map[string]string{"name": strings.Repeat("a", 11)},
+			errors: map[string]string{"Your name": "must be at most 10 characters long"},
+		},
+		{
+			name:   "invalid numbers",
+			values: map[string]string{"name": "Carol", "years": "thirty", "count": "-1", "score": "high"},
+			errors: map[string]string{"Age": "must be a whole number", "Count": "must be a positive whole number", "Score": "must be a number"},
+		},
+		{
+			name:   "number out of range",
+			values: map[string]string{"name": "Dave", "count": "256"},
+			errors: map[string]string{"Count": "must be a positive whole number"},
+		},
+	}
+	for _, test := range tests {
+		var form testForm
+		err := DecodeForm(submission(test.values), &form)
+		if len(test.errors) == 0 {
+			if err != nil {
+				t.Errorf("%s: failed to decode form: %v", test.name, err)
+			} else if form != test.expected {
+				t.Errorf("%s: decoded %+v, expected %+v", test.name, form, test.expected)
+			}
+			continue
+		}
+		var fieldErrors FieldErrors
+		if !errors.As(err, &fieldErrors) {
+			t.Errorf("%s: expected field errors, got %v", test.name, err)
+			continue
+		}
+		got := make(map[string]string)
+		for _, fieldError := range fieldErrors {
+			got[fieldError.Label] = fieldError.Message
+		}
+		if !reflect.DeepEqual(got, test.errors) {
+			t.Errorf("%s: got field errors %v, expected %v", test.name, got, test.errors)
+		}
+	}
+}
+
+func TestDecodeFormNotPointer(t *testing.T) {
+	if err := DecodeForm(submission(nil), testForm{}); err == nil {
+		t.Error("expected decoding into a struct value to fail")
+	}
+}
+
+func TestParseForm(t *testing.T) {
+	fields, err := parseForm(reflect.TypeOf(testForm{}))
+	if err != nil {
+		t.Fatalf("failed to parse form: %v", err)
+	}
+	ids := make([]string, len(fields))
+	for i, field := range fields {
+		ids[i] = field.id
+	}
+	if expected := []string{"name", "years", "count", "score", "code"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("parsed fields %v, expected %v", ids, expected)
+	}
+	name := fields[0].input(reflect.ValueOf("Alice"))
+	if name.Label != "Your name" || !name.Required || name.MinLength != 2 || name.MaxLength != 10 || name.Value != "Alice" {
+		t.Errorf("unexpected input for the name field: %+v", name)
+	}
+	if score := fields[3].input(reflect.ValueOf(0.0)); score.Placeholder != "0.5" || score.Value != "" {
+		t.Errorf("unexpected input for the score field: %+v", score)
+	}
+}
+
+func TestParseFormInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		form interface{}
+	}{
+		{"not a struct", ""},
+		{"no fields", struct{}{}},
+		{"unsupported type", struct{ Tags []string }{}},
+		{"invalid length", struct {
+			Name string `modal:"min_length:two"`
+		}{}},
+		{"invalid pattern", struct {
+			Name string `modal:"pattern:("`
+		}{}},
+		{"label too long", struct {
+			Name string `modal:"label:This label is far too long to be shown in a modal"`
+		}{}},
+		{"too many fields", struct{ A, B, C, D, E, F string }{}},
+	}
+	for _, test := range tests {
+		if _, err := parseForm(reflect.TypeOf(test.form)); err == nil {
+			t.Errorf("%s: expected parsing the form to fail", test.name)
+		}
+	}
+}
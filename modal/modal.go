@@ -1,18 +1,64 @@
 package modal
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/sylvrs/fuse/utils"
 )
 
 type ModalHandlerFunc func(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error)
+
+// ContextHandlerFunc handles a submitted modal with the context of its interaction
+// The submission the modal was sent with can be retrieved with SubmissionFromContext
+type ContextHandlerFunc func(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error)
+
+// Adapt adapts a handler that does not take a context so that it can be used wherever a ContextHandlerFunc is expected
+func Adapt(handler ModalHandlerFunc) ContextHandlerFunc {
+	return func(_ context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+		return handler(s, i)
+	}
+}
+
+type submissionKey struct{}
+
+// SubmissionFromContext returns the submission of the modal being handled, or nil if there is none
+func SubmissionFromContext(ctx context.Context) *Submission {
+	submission, _ := ctx.Value(submissionKey{}).(*Submission)
+	return submission
+}
+
+// SubmitHandlerFunc handles a submitted modal along with the context it was sent with
+type SubmitHandlerFunc func(s *discordgo.Session, i *discordgo.InteractionCreate, submission *Submission) (*discordgo.InteractionResponse, error)
+
+// PayloadHandlerFunc handles a submitted modal along with the typed payload it was sent with
+type PayloadHandlerFunc[T any] func(s *discordgo.Session, i *discordgo.InteractionCreate, payload T) (*discordgo.InteractionResponse, error)
+
+// OnPayload adapts a payload handler so that it can be used as the OnSubmit handler of a modal
+// e.g. m.OnSubmit = modal.OnPayload(func(s *discordgo.Session, i *discordgo.InteractionCreate, message *discordgo.Message) ...)
+func OnPayload[T any](handler PayloadHandlerFunc[T]) SubmitHandlerFunc {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate, submission *Submission) (*discordgo.InteractionResponse, error) {
+		payload, err := Payload[T](submission)
+		if err != nil {
+			return nil, err
+		}
+		return handler(s, i, payload)
+	}
+}
+
 type Modal struct {
 	Id         string
 	Title      string
 	Components []discordgo.MessageComponent
 	Handler    ModalHandlerFunc
+	// OnSubmit is used instead of Handler if set and receives the data the modal was sent with
+	OnSubmit SubmitHandlerFunc
+	// ContextHandler is used instead of Handler and OnSubmit if set
+	ContextHandler ContextHandlerFunc
+	// TTL is how long the modal can be submitted after being sent, DefaultModalTTL is used if zero
+	TTL time.Duration
 }
 
 func NewModal(id, title string, components []discordgo.MessageComponent, handler ModalHandlerFunc) *Modal {
@@ -39,10 +85,13 @@ func NewTextModal(id, title string, inputs []discordgo.TextInput, handler ModalH
 // This is useful for creating static modals that can be reused but have different data.
 func (m *Modal) Clone() *Modal {
 	return &Modal{
-		Id:         m.Id,
-		Title:      m.Title,
-		Components: m.Components,
-		Handler:    m.Handler,
+		Id:             m.Id,
+		Title:          m.Title,
+		Components:     m.Components,
+		Handler:        m.Handler,
+		OnSubmit:       m.OnSubmit,
+		TTL:            m.TTL,
+		ContextHandler: m.ContextHandler,
 	}
 }
 
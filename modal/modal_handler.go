@@ -1,45 +1,216 @@
 package modal
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/utils"
 )
 
+const (
+	// DefaultModalTTL is how long a sent modal can be submitted when the modal does not specify a TTL
+	DefaultModalTTL = 15 * time.Minute
+	// maxCustomIdLength is the maximum length of a custom ID allowed by Discord
+	maxCustomIdLength = 100
+	// modalSweepInterval is how often expired modals are removed
+	modalSweepInterval = time.Minute
+)
+
+// Submission holds the context of a submitted modal
+type Submission struct {
+	// Modal is the modal that was submitted
+	Modal *Modal
+	// UserID is the ID of the user the modal was sent to
+	UserID string
+	// SentAt is the time the modal was sent
+	SentAt time.Time
+	// Data is the data passed to SendWithData, e.g. the message being edited
+	Data any
+}
+
+// Payload returns the data the modal was sent with as a value of type T
+// If the modal was sent without data, the zero value of T is returned
+func Payload[T any](submission *Submission) (T, error) {
+	var payload T
+	if submission.Data == nil {
+		return payload, nil
+	}
+	payload, ok := submission.Data.(T)
+	if !ok {
+		return payload, fmt.Errorf("modal payload is %T, expected %T", submission.Data, payload)
+	}
+	return payload, nil
+}
+
+// pendingModal is a modal that has been sent but not submitted yet
+type pendingModal struct {
+	modal      *Modal
+	submission *Submission
+	expiresAt  time.Time
+	// retry is set by KeepPending when the submission was rejected and the modal may be submitted again
+	retry bool
+}
+
+type pendingKey struct{}
+
+// KeepPending keeps the modal being handled pending after its handler returns, so that it can be submitted again
+// This is used when a submission is rejected, e.g. because of invalid values. Modals are kept pending automatically if their handler fails
+func KeepPending(ctx context.Context) {
+	if pending, ok := ctx.Value(pendingKey{}).(*pendingModal); ok {
+		pending.retry = true
+	}
+}
+
 type ModalHandler struct {
 	session       *discordgo.Session
 	guild         *discordgo.Guild
-	pendingModals map[string]*Modal
+	mutex         sync.Mutex
+	pendingModals map[string]*pendingModal
+	stop          chan struct{}
 }
 
 func NewModalHandler(session *discordgo.Session, guild *discordgo.Guild) *ModalHandler {
 	return &ModalHandler{
 		session:       session,
 		guild:         guild,
-		pendingModals: make(map[string]*Modal),
+		pendingModals: make(map[string]*pendingModal),
 	}
 }
 
 // Send is used to send a modal to a user based on an interaction
+// Any interaction that can be responded to with a modal may be used, including components, context menus and DMs
 // This will return an interaction response that can be used to send the modal
 func (h *ModalHandler) Send(i *discordgo.InteractionCreate, m *Modal) (*discordgo.InteractionResponse, error) {
-	data := m.ModalData(i.Member.User.ID)
-	h.pendingModals[data.CustomID] = m.Clone()
+	return h.SendWithData(i, m, nil)
+}
+
+// SendWithData sends a modal like Send but carries the data through to the modal's OnSubmit handler
+// Every sent modal gets its own custom ID, so a user may have multiple modals of the same kind open at once
+func (h *ModalHandler) SendWithData(i *discordgo.InteractionCreate, m *Modal, data any) (*discordgo.InteractionResponse, error) {
+	user := utils.InteractionUser(i.Interaction)
+	if user == nil {
+		return nil, errors.New("interaction has no user")
+	}
+	modalData := m.ModalData(utils.RandomId(8))
+	if len(modalData.CustomID) > maxCustomIdLength {
+		return nil, fmt.Errorf("modal id '%s' is too long", m.Id)
+	}
+	ttl := m.TTL
+	if ttl <= 0 {
+		ttl = DefaultModalTTL
+	}
+	now := time.Now()
+	h.mutex.Lock()
+	h.pendingModals[modalData.CustomID] = &pendingModal{
+		modal: m.Clone(),
+		submission: &Submission{
+			Modal:  m,
+			UserID: user.ID,
+			SentAt: now,
+			Data:   data,
+		},
+		expiresAt: now.Add(ttl),
+	}
+	h.mutex.Unlock()
 	// return the interaction response
 	return &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseModal,
-		Data: data,
+		Data: modalData,
 	}, nil
 }
 
 func (h *ModalHandler) Handle(i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
-	// get the modal from the pending modals
-	m, ok := h.pendingModals[i.ModalSubmitData().CustomID]
+	return h.HandleContext(context.Background(), i)
+}
+
+// HandleContext handles the submitted modal with the context of its interaction
+func (h *ModalHandler) HandleContext(ctx context.Context, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	customId := i.ModalSubmitData().CustomID
+	// take the modal from the pending modals so that it is not handled twice at once
+	h.mutex.Lock()
+	pending, ok := h.pendingModals[customId]
+	delete(h.pendingModals, customId)
+	h.mutex.Unlock()
 	if !ok {
-		return nil, fmt.Errorf("modal '%s' not found", i.ModalSubmitData().CustomID)
+		return nil, fmt.Errorf("modal '%s' not found", customId)
+	}
+	if time.Now().After(pending.expiresAt) {
+		return nil, errors.New("this form has expired, please try again")
+	}
+	pending.retry = false
+	res, err := h.dispatch(ctx, pending, i)
+	// the modal is only used up once it has been handled successfully
+	if err != nil || pending.retry {
+		h.mutex.Lock()
+		if _, taken := h.pendingModals[customId]; !taken {
+			h.pendingModals[customId] = pending
+		}
+		h.mutex.Unlock()
+	}
+	return res, err
+}
+
+// dispatch calls the handler of the pending modal
+func (h *ModalHandler) dispatch(ctx context.Context, pending *pendingModal, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	switch {
+	case pending.modal.ContextHandler != nil:
+		ctx = context.WithValue(ctx, submissionKey{}, pending.submission)
+		return pending.modal.ContextHandler(context.WithValue(ctx, pendingKey{}, pending), h.session, i)
+	case pending.modal.OnSubmit != nil:
+		return pending.modal.OnSubmit(h.session, i, pending.submission)
+	case pending.modal.Handler != nil:
+		return pending.modal.Handler(h.session, i)
+	}
+	return nil, fmt.Errorf("modal '%s' has no handler", pending.modal.Id)
+}
+
+// Start starts removing expired modals in the background
+func (h *ModalHandler) Start() {
+	if h.stop != nil {
+		return
+	}
+	h.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(modalSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				h.sweep(now)
+			case <-stop:
+				return
+			}
+		}
+	}(h.stop)
+}
+
+// Stop stops removing expired modals in the background
+func (h *ModalHandler) Stop() {
+	if h.stop != nil {
+		close(h.stop)
+		h.stop = nil
+	}
+}
+
+// Pending returns the number of modals that have been sent but not submitted or expired yet
+func (h *ModalHandler) Pending() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.pendingModals)
+}
+
+// sweep removes every modal that can no longer be submitted
+// Discord does not tell us when a modal is closed, so this is the only way they are cleaned up
+func (h *ModalHandler) sweep(now time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for customId, pending := range h.pendingModals {
+		if now.After(pending.expiresAt) {
+			delete(h.pendingModals, customId)
+		}
 	}
-	// delete the modal from the pending modals
-	delete(h.pendingModals, i.ModalSubmitData().CustomID)
-	// call the modal handler
-	return m.Handler(h.session, i)
 }
@@ -0,0 +1,171 @@
+package notify
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultPollInterval is the interval used by the database bus when none is provided
+	DefaultPollInterval = 2 * time.Second
+	// eventRetention is how long events are kept in the database before being pruned
+	eventRetention = time.Hour
+	// pollBatchSize is the maximum number of events read per poll
+	pollBatchSize = 100
+	// gapTimeout is how long a skipped ID is watched for an event that commits late before it is assumed to be rolled back
+	gapTimeout = time.Minute
+	// maxGaps is the maximum number of skipped IDs that are watched at the same time
+	maxGaps = 1000
+)
+
+// ChangeEvent is the database representation of an event
+type ChangeEvent struct {
+	ID          uint64 `gorm:"primaryKey;autoIncrement"`
+	Kind        string
+	GuildID     string
+	ConfigTable string
+	Origin      string
+	CreatedAt   time.Time `gorm:"index"`
+}
+
+// DatabaseBus is a bus that stores events in a table and polls it for new ones
+// It only relies on plain inserts and selects, so it works on any database supported by gorm (e.g. SQLite and Postgres)
+type DatabaseBus struct {
+	connection  *gorm.DB
+	interval    time.Duration
+	subscribers *subscribers
+	lastId      uint64
+	// gaps holds the IDs below lastId that had not been committed when they were passed, along with when they were seen
+	// Under concurrent writers, a transaction holding a lower ID may commit after one holding a higher ID
+	gaps      map[uint64]time.Time
+	lastPrune time.Time
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewDatabaseBus creates the event table if needed and starts polling it for new events
+// Only events published after the bus was created are delivered
+func NewDatabaseBus(connection *gorm.DB, interval time.Duration) (*DatabaseBus, error) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	if err := connection.AutoMigrate(&ChangeEvent{}); err != nil {
+		return nil, err
+	}
+	var lastId uint64
+	if err := connection.Model(&ChangeEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&lastId).Error; err != nil {
+		return nil, err
+	}
+	b := &DatabaseBus{
+		connection:  connection,
+		interval:    interval,
+		subscribers: newSubscribers(),
+		lastId:      lastId,
+		gaps:        make(map[uint64]time.Time),
+		lastPrune:   time.Now(),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go b.run()
+	return b, nil
+}
+
+// Publish stores the event so that every polling process will receive it
+func (b *DatabaseBus) Publish(event Event) error {
+	return b.connection.Create(&ChangeEvent{
+		Kind:        string(event.Kind),
+		GuildID:     event.GuildID,
+		ConfigTable: event.Table,
+		Origin:      event.Origin,
+	}).Error
+}
+
+func (b *DatabaseBus) Subscribe(handler Handler) func() {
+	return b.subscribers.add(handler)
+}
+
+// Close stops polling for events
+func (b *DatabaseBus) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.stop)
+		<-b.done
+	})
+	return nil
+}
+
+// pollGaps dispatches the events that have been committed late and stops watching the gaps that timed out
+func (b *DatabaseBus) pollGaps() {
+	if len(b.gaps) == 0 {
+		return
+	}
+	ids := make([]uint64, 0, len(b.gaps))
+	for id := range b.gaps {
+		ids = append(ids, id)
+	}
+	var events []ChangeEvent
+	if err := b.connection.Where("id IN ?", ids).Order("id").Find(&events).Error; err != nil {
+		return
+	}
+	for _, event := range events {
+		delete(b.gaps, event.ID)
+		b.dispatch(event)
+	}
+	for id, seen := range b.gaps {
+		if time.Since(seen) > gapTimeout {
+			delete(b.gaps, id)
+		}
+	}
+}
+
+// dispatch passes a stored event to the subscribers
+func (b *DatabaseBus) dispatch(event ChangeEvent) {
+	b.subscribers.dispatch(Event{
+		Kind:    Kind(event.Kind),
+		GuildID: event.GuildID,
+		Table:   event.ConfigTable,
+		Origin:  event.Origin,
+	})
+}
+
+func (b *DatabaseBus) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.poll()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// poll reads new events from the database and dispatches them to the subscribers
+func (b *DatabaseBus) poll() {
+	b.pollGaps()
+	for {
+		var events []ChangeEvent
+		if err := b.connection.Where("id > ?", b.lastId).Order("id").Limit(pollBatchSize).Find(&events).Error; err != nil {
+			return
+		}
+		now := time.Now()
+		for _, event := range events {
+			for id := b.lastId + 1; id < event.ID && len(b.gaps) < maxGaps; id++ {
+				b.gaps[id] = now
+			}
+			b.lastId = event.ID
+			b.dispatch(event)
+		}
+		if len(events) < pollBatchSize {
+			break
+		}
+	}
+	if time.Since(b.lastPrune) > eventRetention {
+		b.connection.Where("created_at < ?", time.Now().Add(-eventRetention)).Delete(&ChangeEvent{})
+		b.lastPrune = time.Now()
+	}
+}
@@ -0,0 +1,25 @@
+package notify
+
+// LocalBus is a bus that only delivers events within the current process
+// It is used by default when no other bus is configured
+type LocalBus struct {
+	subscribers *subscribers
+}
+
+func NewLocalBus() *LocalBus {
+	return &LocalBus{subscribers: newSubscribers()}
+}
+
+// Publish delivers the event to every subscriber synchronously
+func (b *LocalBus) Publish(event Event) error {
+	b.subscribers.dispatch(event)
+	return nil
+}
+
+func (b *LocalBus) Subscribe(handler Handler) func() {
+	return b.subscribers.add(handler)
+}
+
+func (b *LocalBus) Close() error {
+	return nil
+}
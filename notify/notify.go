@@ -0,0 +1,36 @@
+package notify
+
+// Kind describes what kind of data an event refers to
+type Kind string
+
+const (
+	// KindServiceConfig is published when a service configuration is saved
+	KindServiceConfig Kind = "service_config"
+	// KindGuildConfig is published when the built-in guild configuration is saved
+	KindGuildConfig Kind = "guild_config"
+)
+
+// Event is a notification that some data was changed by a process
+type Event struct {
+	// Kind is the kind of data that was changed
+	Kind Kind
+	// GuildID is the ID of the guild the data belongs to
+	GuildID string
+	// Table is the database table of the changed data, if any
+	Table string
+	// Origin identifies the publisher so that it can ignore its own events
+	Origin string
+}
+
+// Handler is called for every event received by a bus
+type Handler func(event Event)
+
+// Bus is used to notify every process sharing a database about changes
+type Bus interface {
+	// Publish sends the event to every subscriber
+	Publish(event Event) error
+	// Subscribe registers a handler and returns a function that removes it again
+	Subscribe(handler Handler) (unsubscribe func())
+	// Close stops the bus and releases its resources
+	Close() error
+}
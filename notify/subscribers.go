@@ -0,0 +1,39 @@
+package notify
+
+import "sync"
+
+// subscribers is a set of handlers shared by the bus implementations
+type subscribers struct {
+	mutex    sync.RWMutex
+	nextId   int
+	handlers map[int]Handler
+}
+
+func newSubscribers() *subscribers {
+	return &subscribers{handlers: make(map[int]Handler)}
+}
+
+func (s *subscribers) add(handler Handler) func() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := s.nextId
+	s.nextId++
+	s.handlers[id] = handler
+	return func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		delete(s.handlers, id)
+	}
+}
+
+func (s *subscribers) dispatch(event Event) {
+	s.mutex.RLock()
+	handlers := make([]Handler, 0, len(s.handlers))
+	for _, handler := range s.handlers {
+		handlers = append(handlers, handler)
+	}
+	s.mutex.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
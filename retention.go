@@ -0,0 +1,143 @@
+package fuse
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultGuildRetention is how long the data of a guild is kept after leaving it when no retention is configured
+	DefaultGuildRetention = 30 * 24 * time.Hour
+	// guildPurgeInterval is how often the manager checks for guilds whose retention period has passed
+	guildPurgeInterval = time.Hour
+)
+
+// errGuildRestored aborts the purge of a guild that has been joined again since it was found to be expired
+var errGuildRestored = errors.New("guild was restored")
+
+// CleanupFunc removes all data stored for a guild that is being purged
+type CleanupFunc func(connection *gorm.DB, guildID string) error
+
+// ServiceCleaner can be implemented by services that store data outside of their service configuration
+// Cleanup is registered automatically when the service is registered
+type ServiceCleaner interface {
+	// Cleanup removes all data stored by the service for the guild
+	Cleanup(connection *gorm.DB, guildID string) error
+}
+
+// cleanupHook is a named cleanup function
+type cleanupHook struct {
+	name string
+	f    CleanupFunc
+}
+
+// RegisterCleanup registers a function that is called when the data of a guild is purged
+// Only the registered service configuration types and fuse's own tables are purged automatically,
+// so any other data stored for a guild must be removed by a cleanup function or a ServiceCleaner
+func (mng *Manager) RegisterCleanup(name string, f CleanupFunc) {
+	mng.cleanupHooks = append(mng.cleanupHooks, cleanupHook{name: name, f: f})
+}
+
+// retention returns the configured retention period for the data of guilds that were left
+func (mng *Manager) retention() time.Duration {
+	if mng.config.GuildRetention == 0 {
+		return DefaultGuildRetention
+	}
+	return mng.config.GuildRetention
+}
+
+// purgeGuild removes every piece of data stored for the guild if its retention period has passed
+// Everything is removed in a single transaction, which is aborted if the guild has been joined again in the meantime
+func (mng *Manager) purgeGuild(guildID string) error {
+	cutoff := time.Now().Add(-mng.retention())
+	expired := func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("guild_id = ? AND left_at IS NOT NULL AND left_at <= ?", guildID, cutoff)
+	}
+	err := mng.connection.Transaction(func(tx *gorm.DB) error {
+		var guild GuildConfiguration
+		if expired(tx).Limit(1).Find(&guild).RowsAffected == 0 {
+			return errGuildRestored
+		}
+		for _, hook := range mng.cleanupHooks {
+			if err := hook.f(tx, guildID); err != nil {
+				return fmt.Errorf("cleanup '%s' failed: %w", hook.name, err)
+			}
+		}
+		models := []interface{}{&ComponentState{}, &AuditEntry{}}
+		for _, t := range mng.ConfigTypes() {
+			models = append(models, reflect.New(t).Interface())
+		}
+		for _, model := range models {
+			// configuration types that have never been fetched have no table yet
+			if !tx.Migrator().HasTable(model) {
+				continue
+			}
+			if err := tx.Where("guild_id = ?", guildID).Delete(model).Error; err != nil {
+				return fmt.Errorf("failed to delete %T: %w", model, err)
+			}
+		}
+		// the guild configuration is deleted last and only if the guild has not been restored while purging it
+		result := expired(tx).Delete(&GuildConfiguration{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errGuildRestored
+		}
+		return nil
+	})
+	if errors.Is(err, errGuildRestored) {
+		mng.logger.Info("Skipped purging guild data as the guild was joined again", "guild", guildID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	mng.logger.Info("Purged guild data", "guild", guildID)
+	return nil
+}
+
+// purgeExpiredGuilds purges every guild that was left longer ago than the retention period
+func (mng *Manager) purgeExpiredGuilds() {
+	var guilds []*GuildConfiguration
+	if err := mng.connection.Where("left_at IS NOT NULL AND left_at < ?", time.Now().Add(-mng.retention())).Find(&guilds).Error; err != nil {
+		mng.logger.Error("Failed to find expired guilds", "error", err)
+		return
+	}
+	for _, guild := range guilds {
+		if err := mng.purgeGuild(guild.GuildID); err != nil {
+			mng.logger.Error("Failed to purge guild data", "guild", guild.GuildID, "error", err)
+		}
+	}
+}
+
+// startGuildPurger periodically purges the data of guilds and the audit entries whose retention period has passed
+func (mng *Manager) startGuildPurger() {
+	mng.purgeStop = make(chan struct{})
+	go func() {
+		mng.purgeExpiredGuilds()
+		mng.purgeExpiredAuditEntries()
+		ticker := time.NewTicker(guildPurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				mng.purgeExpiredGuilds()
+				mng.purgeExpiredAuditEntries()
+			case <-mng.purgeStop:
+				return
+			}
+		}
+	}()
+}
+
+func (mng *Manager) stopGuildPurger() {
+	if mng.purgeStop != nil {
+		close(mng.purgeStop)
+		mng.purgeStop = nil
+	}
+}
@@ -0,0 +1,51 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// httpShutdownTimeout is how long the HTTP server waits for open requests when the manager stops
+	httpShutdownTimeout = 5 * time.Second
+)
+
+// startHTTPServer starts the local HTTP server if an address is configured
+func (mng *Manager) startHTTPServer() error {
+	if mng.config.HTTPAddress == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", mng.registry.Handler())
+	mux.HandleFunc("/healthz", mng.handleHealth)
+	mux.HandleFunc("/readyz", mng.handleReady)
+	mux.HandleFunc("/status", mng.handleStatus)
+	listener, err := net.Listen("tcp", mng.config.HTTPAddress)
+	if err != nil {
+		return err
+	}
+	mng.httpServer = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func(server *http.Server) {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			mng.logger.Error("HTTP server stopped", "error", err)
+		}
+	}(mng.httpServer)
+	mng.logger.Info("Started HTTP server", "address", listener.Addr().String())
+	return nil
+}
+
+// stopHTTPServer stops the local HTTP server, waiting for open requests to finish
+func (mng *Manager) stopHTTPServer() {
+	if mng.httpServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	if err := mng.httpServer.Shutdown(ctx); err != nil {
+		mng.logger.Error("Failed to stop HTTP server", "error", err)
+	}
+	mng.httpServer = nil
+}
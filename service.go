@@ -1,5 +1,10 @@
 package fuse
 
+import (
+	"context"
+	"reflect"
+)
+
 // Service is the interface that all services must implement
 // It defines the methods that are called when the service is started or stopped
 type Service interface {
@@ -11,9 +16,100 @@ type Service interface {
 	Stop(mng *GuildManager) error
 }
 
+// ConfiguredService can be implemented by services that store a service configuration
+// The configuration types are registered along with the service, so that the built-in commands know about them
+// before any guild has fetched its configuration, e.g. right after a restart
+type ConfiguredService interface {
+	// Configs returns a value of every configuration type used by the service, e.g. []interface{}{&MyServiceConfig{}}
+	Configs() []interface{}
+}
+
+// ToggleableService can be implemented by services that can be enabled or disabled per guild, e.g. through a setting
+// Disabled services are not started, and services are started or stopped by RefreshServices when they are toggled
+type ToggleableService interface {
+	// Enabled returns whether the service should run in the guild
+	Enabled(mng *GuildManager) bool
+}
+
+// ContextService is the context-aware generation of Service
+// Start receives a context that is cancelled when the guild manager stops, which can be used for background work
+// Stop receives a context that expires once the service has taken too long to stop
+type ContextService interface {
+	// Create creates a new instance of the service for a provided guild manager
+	Create(mng *GuildManager) (ContextService, error)
+	// Start is called when the service is started
+	Start(ctx context.Context, mng *GuildManager) error
+	// Stop is called when the service is stopped
+	Stop(ctx context.Context, mng *GuildManager) error
+}
+
+// AdaptService adapts a service that does not take a context so that it can be used wherever a ContextService is expected
+func AdaptService(s Service) ContextService {
+	return &serviceAdapter{service: s}
+}
+
+type serviceAdapter struct {
+	service Service
+}
+
+func (a *serviceAdapter) Create(mng *GuildManager) (ContextService, error) {
+	service, err := a.service.Create(mng)
+	if err != nil {
+		return nil, err
+	}
+	return AdaptService(service), nil
+}
+
+func (a *serviceAdapter) Start(_ context.Context, mng *GuildManager) error {
+	return a.service.Start(mng)
+}
+
+func (a *serviceAdapter) Stop(_ context.Context, mng *GuildManager) error {
+	return a.service.Stop(mng)
+}
+
+// unwrapService returns the service adapted by AdaptService, or the service itself if it was not adapted
+func unwrapService(s ContextService) any {
+	if adapter, ok := s.(*serviceAdapter); ok {
+		return adapter.service
+	}
+	return s
+}
+
+// serviceEnabled returns whether the service should run in the guild
+// Services that do not implement ToggleableService are always enabled
+func serviceEnabled(s ContextService, mng *GuildManager) bool {
+	if toggleable, ok := unwrapService(s).(ToggleableService); ok {
+		return toggleable.Enabled(mng)
+	}
+	return true
+}
+
+// serviceName returns the name of the service's type
+func serviceName(s ContextService) string {
+	t := reflect.TypeOf(unwrapService(s))
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
 // ServiceConfiguration is a simple struct used to store a service's configuration in the database
 // This is not always required but has a configured guild ID field for convenience
 type ServiceConfiguration struct {
 	// GuildID is the ID of the guild and is used as the primary key
 	GuildId string `gorm:"primary_key"`
+	// Version is incremented every time the configuration is saved and is used to detect concurrent modifications
+	Version uint64 `gorm:"not null;default:0"`
+}
+
+// serviceConfiguration returns the embedded service configuration
+// This allows the guild manager to access the version of any configuration that embeds ServiceConfiguration
+func (c *ServiceConfiguration) serviceConfiguration() *ServiceConfiguration {
+	return c
+}
+
+// versionedConfiguration is implemented by every configuration that embeds ServiceConfiguration
+type versionedConfiguration interface {
+	serviceConfiguration() *ServiceConfiguration
 }
@@ -0,0 +1,535 @@
+package fuse
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sylvrs/fuse/command"
+	"github.com/sylvrs/fuse/utils"
+)
+
+const (
+	// settingsCommandName is the name of the built-in settings command
+	settingsCommandName = "settings"
+	// settingsTag is the struct tag used to describe a setting
+	// It uses the same format as gorm, e.g. `settings:"description:The channel to greet members in;type:channel"`
+	// A type is only exposed through the settings command if at least one of its fields has this tag
+	settingsTag = "settings"
+	// maxSettingsOptions is the maximum number of options Discord allows for a subcommand
+	maxSettingsOptions = 25
+	// maxSettingsGroups is the maximum number of subcommands Discord allows for a command
+	maxSettingsGroups = 25
+)
+
+// settingKind describes how a setting is represented in Discord
+type settingKind int
+
+const (
+	settingString settingKind = iota
+	settingInteger
+	settingNumber
+	settingBoolean
+	settingChannel
+	settingRole
+	settingUser
+	settingList
+)
+
+var settingKindsByName = map[string]settingKind{
+	"string":  settingString,
+	"integer": settingInteger,
+	"number":  settingNumber,
+	"boolean": settingBoolean,
+	"channel": settingChannel,
+	"role":    settingRole,
+	"user":    settingUser,
+	"list":    settingList,
+}
+
+// settingsField is a single editable field of a service configuration
+type settingsField struct {
+	index       int
+	name        string
+	label       string
+	description string
+	kind        settingKind
+	min         *float64
+	max         *float64
+	minLength   *int
+	maxLength   *int
+	choices     []string
+	pattern     *regexp.Regexp
+}
+
+// settingsGroup is the set of editable fields of a single service configuration
+type settingsGroup struct {
+	name        string
+	description string
+	configType  reflect.Type
+	fields      []*settingsField
+}
+
+// parseSettingsGroup reads the settings tags of a configuration type
+// It returns nil if the type does not have any tagged fields
+func parseSettingsGroup(t reflect.Type) (*settingsGroup, error) {
+	group := &settingsGroup{
+		name:        settingsGroupName(t.Name()),
+		description: fmt.Sprintf("Edit the settings of %s", utils.HumanCase(t.Name())),
+		configType:  t,
+	}
+	tagged := false
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		tag, ok := structField.Tag.Lookup(settingsTag)
+		tagged = tagged || ok
+		if structField.Anonymous && structField.Type == reflect.TypeOf(ServiceConfiguration{}) {
+			// the embedded service configuration may be used to name and describe the group
+			options := utils.ParseTag(tag)
+			if name, ok := options["name"]; ok {
+				group.name = name
+			}
+			if description, ok := options["description"]; ok {
+				group.description = description
+			}
+			continue
+		}
+		if !structField.IsExported() || tag == "-" {
+			continue
+		}
+		field, err := parseSettingsField(i, structField, tag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid setting %s.%s: %w", t.Name(), structField.Name, err)
+		}
+		if field != nil {
+			group.fields = append(group.fields, field)
+		}
+	}
+	if !tagged {
+		return nil, nil
+	}
+	if len(group.fields) > maxSettingsOptions {
+		return nil, fmt.Errorf("%s has more than %d settings", t.Name(), maxSettingsOptions)
+	}
+	return group, nil
+}
+
+// settingsGroupName derives the subcommand name from a configuration type name
+// e.g. `WelcomeServiceConfiguration` becomes `welcome`
+func settingsGroupName(typeName string) string {
+	for _, suffix := range []string{"ServiceConfiguration", "ServiceConfig", "Configuration", "Config"} {
+		if trimmed := strings.TrimSuffix(typeName, suffix); trimmed != typeName && trimmed != "" {
+			typeName = trimmed
+			break
+		}
+	}
+	return utils.SnakeCase(typeName)
+}
+
+// parseSettingsField reads the settings tag of a single field
+// It returns nil if the field type cannot be edited and was not explicitly tagged
+func parseSettingsField(index int, structField reflect.StructField, tag string) (*settingsField, error) {
+	options := utils.ParseTag(tag)
+	field := &settingsField{
+		index:       index,
+		name:        utils.SnakeCase(structField.Name),
+		label:       utils.HumanCase(structField.Name),
+		description: fmt.Sprintf("The %s setting", strings.ToLower(utils.HumanCase(structField.Name))),
+	}
+	if name, ok := options["name"]; ok {
+		field.name = name
+	}
+	if description, ok := options["description"]; ok {
+		field.description = description
+	}
+
+	kind, ok := inferSettingKind(structField.Type)
+	if name, hasType := options["type"]; hasType {
+		kind, ok = settingKindsByName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown type '%s'", name)
+		}
+		if !settingKindMatches(kind, structField.Type) {
+			return nil, fmt.Errorf("type '%s' cannot be stored in a %s", name, structField.Type)
+		}
+	}
+	if !ok {
+		if tag != "" {
+			return nil, fmt.Errorf("unsupported field type %s", structField.Type)
+		}
+		return nil, nil
+	}
+	field.kind = kind
+	if kind == settingList {
+		field.description = fmt.Sprintf("%s (comma-separated)", field.description)
+	}
+
+	var err error
+	if field.min, err = parseFloatOption(options, "min"); err != nil {
+		return nil, err
+	}
+	if field.max, err = parseFloatOption(options, "max"); err != nil {
+		return nil, err
+	}
+	if field.min == nil && structField.Type.Kind() >= reflect.Uint && structField.Type.Kind() <= reflect.Uint64 {
+		zero := 0.0
+		field.min = &zero
+	}
+	if field.minLength, err = parseIntOption(options, "min_length"); err != nil {
+		return nil, err
+	}
+	if field.maxLength, err = parseIntOption(options, "max_length"); err != nil {
+		return nil, err
+	}
+	if choices, ok := options["choices"]; ok {
+		field.choices = strings.Split(choices, ",")
+	}
+	if pattern, ok := options["pattern"]; ok {
+		if field.pattern, err = regexp.Compile(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+func parseFloatOption(options map[string]string, key string) (*float64, error) {
+	raw, ok := options[key]
+	if !ok {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s '%s'", key, raw)
+	}
+	return &value, nil
+}
+
+func parseIntOption(options map[string]string, key string) (*int, error) {
+	raw, ok := options[key]
+	if !ok {
+		return nil, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s '%s'", key, raw)
+	}
+	return &value, nil
+}
+
+// inferSettingKind returns the setting kind used for a field type when no type is given in the tag
+func inferSettingKind(t reflect.Type) (settingKind, bool) {
+	switch t.Kind() {
+	case reflect.String:
+		return settingString, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return settingInteger, true
+	case reflect.Float32, reflect.Float64:
+		return settingNumber, true
+	case reflect.Bool:
+		return settingBoolean, true
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.String {
+			return settingList, true
+		}
+	}
+	return 0, false
+}
+
+// settingKindMatches returns true if a setting of the kind can be stored in the field type
+func settingKindMatches(kind settingKind, t reflect.Type) bool {
+	switch kind {
+	case settingChannel, settingRole, settingUser:
+		return t.Kind() == reflect.String
+	case settingList:
+		return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String
+	}
+	inferred, ok := inferSettingKind(t)
+	return ok && (inferred == kind || (inferred == settingInteger && kind == settingNumber))
+}
+
+// option creates the command option used to edit the field
+func (f *settingsField) option() *discordgo.ApplicationCommandOption {
+	option := &discordgo.ApplicationCommandOption{
+		Name:        f.name,
+		Description: f.description,
+		MinValue:    f.min,
+	}
+	if f.max != nil {
+		option.MaxValue = *f.max
+	}
+	// lengths of list items are only validated once the list has been split
+	if f.kind == settingString {
+		option.MinLength = f.minLength
+		if f.maxLength != nil {
+			option.MaxLength = *f.maxLength
+		}
+	}
+	switch f.kind {
+	case settingString, settingList:
+		option.Type = discordgo.ApplicationCommandOptionString
+	case settingInteger:
+		option.Type = discordgo.ApplicationCommandOptionInteger
+	case settingNumber:
+		option.Type = discordgo.ApplicationCommandOptionNumber
+	case settingBoolean:
+		option.Type = discordgo.ApplicationCommandOptionBoolean
+	case settingChannel:
+		option.Type = discordgo.ApplicationCommandOptionChannel
+	case settingRole:
+		option.Type = discordgo.ApplicationCommandOptionRole
+	case settingUser:
+		option.Type = discordgo.ApplicationCommandOptionUser
+	}
+	for _, choice := range f.choices {
+		option.Choices = append(option.Choices, &discordgo.ApplicationCommandOptionChoice{Name: choice, Value: choice})
+	}
+	return option
+}
+
+// apply validates the option value and stores it in the field
+func (f *settingsField) apply(option *discordgo.ApplicationCommandInteractionDataOption, value reflect.Value) error {
+	switch f.kind {
+	case settingInteger, settingNumber:
+		number, ok := option.Value.(float64)
+		if !ok {
+			return fmt.Errorf("`%s` must be a number", f.name)
+		}
+		if f.min != nil && number < *f.min {
+			return fmt.Errorf("`%s` must be at least %v", f.name, *f.min)
+		}
+		if f.max != nil && number > *f.max {
+			return fmt.Errorf("`%s` must be at most %v", f.name, *f.max)
+		}
+		switch value.Kind() {
+		case reflect.Float32, reflect.Float64:
+			value.SetFloat(number)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			value.SetUint(uint64(number))
+		default:
+			value.SetInt(int64(number))
+		}
+	case settingBoolean:
+		boolean, ok := option.Value.(bool)
+		if !ok {
+			return fmt.Errorf("`%s` must be true or false", f.name)
+		}
+		value.SetBool(boolean)
+	case settingList:
+		raw, _ := option.Value.(string)
+		items := make([]string, 0)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				if err := f.validateString(item); err != nil {
+					return err
+				}
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items).Convert(value.Type()))
+	default:
+		raw, ok := option.Value.(string)
+		if !ok {
+			return fmt.Errorf("`%s` must be text", f.name)
+		}
+		if f.kind == settingString {
+			if err := f.validateString(raw); err != nil {
+				return err
+			}
+		}
+		value.SetString(raw)
+	}
+	return nil
+}
+
+// validateString checks a string value against the length, choice and pattern constraints of the field
+func (f *settingsField) validateString(value string) error {
+	length := len([]rune(value))
+	if f.minLength != nil && length < *f.minLength {
+		return fmt.Errorf("`%s` must be at least %d characters long", f.name, *f.minLength)
+	}
+	if f.maxLength != nil && length > *f.maxLength {
+		return fmt.Errorf("`%s` must be at most %d characters long", f.name, *f.maxLength)
+	}
+	if len(f.choices) != 0 && !utils.Contains(f.choices, value) {
+		return fmt.Errorf("`%s` must be one of: %s", f.name, strings.Join(f.choices, ", "))
+	}
+	if f.pattern != nil && !f.pattern.MatchString(value) {
+		return fmt.Errorf("`%s` must match `%s`", f.name, f.pattern.String())
+	}
+	return nil
+}
+
+// format returns the value of the field as it should be displayed in Discord
+func (f *settingsField) format(value reflect.Value) string {
+	switch f.kind {
+	case settingChannel, settingRole, settingUser:
+		if value.String() == "" {
+			return "*None*"
+		}
+		prefix := map[settingKind]string{settingChannel: "#", settingRole: "@&", settingUser: "@"}[f.kind]
+		return fmt.Sprintf("<%s%s>", prefix, value.String())
+	case settingList:
+		if value.Len() == 0 {
+			return "*None*"
+		}
+		items := make([]string, value.Len())
+		for i := range items {
+			items[i] = value.Index(i).String()
+		}
+		return strings.Join(items, ", ")
+	case settingString:
+		if value.String() == "" {
+			return "*None*"
+		}
+	}
+	return fmt.Sprintf("%v", value.Interface())
+}
+
+// settingsGroups returns the settings of every registered configuration type with tagged fields
+func (mng *Manager) settingsGroups() []*settingsGroup {
+	groups := make([]*settingsGroup, 0)
+	for _, t := range mng.ConfigTypes() {
+		group, err := parseSettingsGroup(t)
+		if err != nil {
+			mng.logger.Error("Failed to create settings for service configuration", "config", t.Name(), "error", err)
+			continue
+		}
+		if group == nil || len(group.fields) == 0 {
+			continue
+		}
+		if err := validateSettingsGroup(groups, group); err != nil {
+			mng.logger.Error("Failed to create settings for service configuration", "config", t.Name(), "error", err)
+			continue
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// validateSettingsGroup checks that the group can be added as a subcommand next to the existing groups
+func validateSettingsGroup(groups []*settingsGroup, group *settingsGroup) error {
+	if len(groups) >= maxSettingsGroups {
+		return fmt.Errorf("the settings command already has %d groups", maxSettingsGroups)
+	}
+	for _, existing := range groups {
+		if existing.name == group.name {
+			return fmt.Errorf("group name '%s' is already used by %s", group.name, existing.configType.Name())
+		}
+	}
+	return nil
+}
+
+// registerSettingsCommand registers the built-in `/settings` command for every configuration fetched so far
+// Services should fetch their configuration in Create so that it is included
+func (mng *GuildManager) registerSettingsCommand() {
+	groups := mng.manager.settingsGroups()
+	if len(groups) == 0 {
+		return
+	}
+	options := make([]*discordgo.ApplicationCommandOption, len(groups))
+	for i, group := range groups {
+		options[i] = &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        group.name,
+			Description: group.description,
+			Options:     utils.Map(group.fields, (*settingsField).option),
+		}
+	}
+	permission := int64(discordgo.PermissionAdministrator)
+	mng.commandHandler.Register(&command.Command{
+		Name:               settingsCommandName,
+		Description:        "View or change the settings of this server",
+		DefaultPermissions: &permission,
+		Options:            options,
+		Handler: func(_ *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+			return mng.handleSettingsCommand(groups, i)
+		},
+	})
+}
+
+func (mng *GuildManager) handleSettingsCommand(groups []*settingsGroup, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return nil, errors.New("no settings were selected")
+	}
+	subcommand := data.Options[0]
+	var group *settingsGroup
+	for _, current := range groups {
+		if current.name == subcommand.Name {
+			group = current
+			break
+		}
+	}
+	if group == nil {
+		return nil, fmt.Errorf("unknown settings `%s`", subcommand.Name)
+	}
+
+	config := reflect.New(group.configType)
+	if err := mng.FetchServiceConfig(config.Interface()); err != nil {
+		return nil, err
+	}
+
+	fields := make([]*discordgo.MessageEmbedField, 0)
+	before, after := make(map[string]string), make(map[string]string)
+	if len(subcommand.Options) == 0 {
+		// without any options, we simply show the current values
+		for _, field := range group.fields {
+			fields = append(fields, &discordgo.MessageEmbedField{Name: field.label, Value: field.format(config.Elem().Field(field.index)), Inline: true})
+		}
+		return settingsResponse(utils.InfoAsEmbed(fmt.Sprintf("Current settings for `%s`", group.name)), fields), nil
+	}
+
+	for _, option := range subcommand.Options {
+		var field *settingsField
+		for _, current := range group.fields {
+			if current.name == option.Name {
+				field = current
+				break
+			}
+		}
+		if field == nil {
+			return nil, fmt.Errorf("unknown setting `%s`", option.Name)
+		}
+		value := config.Elem().Field(field.index)
+		before[field.name] = field.format(value)
+		if err := field.apply(option, value); err != nil {
+			return nil, err
+		}
+		after[field.name] = field.format(value)
+		fields = append(fields, &discordgo.MessageEmbedField{Name: field.label, Value: field.format(value), Inline: true})
+	}
+	if err := mng.SaveServiceConfig(config.Interface()); err != nil {
+		if errors.Is(err, ErrConfigConflict) {
+			return nil, errors.New("these settings were changed by someone else in the meantime, please try again")
+		}
+		return nil, err
+	}
+	mng.recordAudit(AuditEvent{
+		Action:      "settings.update",
+		TargetType:  "settings",
+		TargetID:    group.name,
+		Before:      before,
+		After:       after,
+		Interaction: i.Interaction,
+	})
+	if err := mng.RefreshServices(); err != nil {
+		mng.logger.Error("Failed to refresh services after changing settings", "error", err)
+	}
+	return settingsResponse(utils.SuccessAsEmbed(fmt.Sprintf("Updated settings for `%s`", group.name)), fields), nil
+}
+
+func settingsResponse(embed *discordgo.MessageEmbed, fields []*discordgo.MessageEmbedField) *discordgo.InteractionResponse {
+	embed.Fields = fields
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags:  discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{embed},
+		},
+	}
+}
@@ -0,0 +1,63 @@
+package fuse
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sylvrs/fuse/tracing"
+	"gorm.io/gorm"
+)
+
+const (
+	// gormSpanKey is the key the span of a database operation is stored under in its statement
+	gormSpanKey = "fuse:span"
+)
+
+// registerTracingCallbacks traces every database operation made with a context carrying a span
+// e.g. mng.Connection().WithContext(mng.InteractionContext(i)).Find(&records)
+func registerTracingCallbacks(db *gorm.DB) error {
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("fuse:trace_before_create", startDatabaseSpan("create")),
+		callbacks.Create().After("gorm:create").Register("fuse:trace_after_create", endDatabaseSpan),
+		callbacks.Query().Before("gorm:query").Register("fuse:trace_before_query", startDatabaseSpan("query")),
+		callbacks.Query().After("gorm:query").Register("fuse:trace_after_query", endDatabaseSpan),
+		callbacks.Update().Before("gorm:update").Register("fuse:trace_before_update", startDatabaseSpan("update")),
+		callbacks.Update().After("gorm:update").Register("fuse:trace_after_update", endDatabaseSpan),
+		callbacks.Delete().Before("gorm:delete").Register("fuse:trace_before_delete", startDatabaseSpan("delete")),
+		callbacks.Delete().After("gorm:delete").Register("fuse:trace_after_delete", endDatabaseSpan),
+		callbacks.Row().Before("gorm:row").Register("fuse:trace_before_row", startDatabaseSpan("row")),
+		callbacks.Row().After("gorm:row").Register("fuse:trace_after_row", endDatabaseSpan),
+		callbacks.Raw().Before("gorm:raw").Register("fuse:trace_before_raw", startDatabaseSpan("raw")),
+		callbacks.Raw().After("gorm:raw").Register("fuse:trace_after_raw", endDatabaseSpan),
+	)
+}
+
+// startDatabaseSpan creates a callback starting a span for the operation if the statement's context carries one
+func startDatabaseSpan(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		_, span := tracing.Start(db.Statement.Context, fmt.Sprintf("db %s", operation), "db.operation", operation, "db.table", db.Statement.Table)
+		if span != nil {
+			db.InstanceSet(gormSpanKey, span)
+		}
+	}
+}
+
+// endDatabaseSpan ends the span started by startDatabaseSpan with the executed statement
+func endDatabaseSpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(*tracing.Span)
+	span.SetAttributes("db.statement", db.Statement.SQL.String(), "db.rows_affected", db.Statement.RowsAffected)
+	if !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+	}
+	span.End()
+}
+
+// Tracer returns the tracer used to trace interactions, or nil if tracing is disabled
+func (mng *Manager) Tracer() *tracing.Tracer {
+	return mng.tracer
+}
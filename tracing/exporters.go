@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// WriterExporter writes every span as a line of JSON
+type WriterExporter struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{encoder: json.NewEncoder(w)}
+}
+
+// NewStdoutExporter creates an exporter writing every span to stdout as a line of JSON
+func NewStdoutExporter() *WriterExporter {
+	return NewWriterExporter(os.Stdout)
+}
+
+func (e *WriterExporter) Export(span SpanData) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	_ = e.encoder.Encode(span)
+}
+
+// InMemoryExporter keeps every span in memory, which is mostly useful for tests
+type InMemoryExporter struct {
+	mutex sync.Mutex
+	spans []SpanData
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{spans: make([]SpanData, 0)}
+}
+
+func (e *InMemoryExporter) Export(span SpanData) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the exported spans in the order they ended
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset removes every exported span
+func (e *InMemoryExporter) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = e.spans[:0]
+}
@@ -0,0 +1,173 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SpanData is a snapshot of a finished span as passed to exporters
+type SpanData struct {
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Name       string         `json:"name"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	// Error is the message of the error recorded on the span, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Duration returns how long the span took
+func (d SpanData) Duration() time.Duration {
+	return d.End.Sub(d.Start)
+}
+
+// Exporter receives every span once it has ended
+// Export is called synchronously when the span ends, so it should not block
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// Tracer creates spans and passes them to its exporter once they end
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer creates a tracer that passes finished spans to the exporter
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Start starts a span as a child of the span in ctx, or as the root of a new trace if ctx has no span
+// The returned context carries the new span. A nil tracer returns ctx and a nil span, which is safe to use
+func (t *Tracer) Start(ctx context.Context, name string, attributes ...any) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			SpanID:     randomId(8),
+			Name:       name,
+			Start:      time.Now(),
+			Attributes: make(map[string]any),
+		},
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.data.TraceID, span.data.ParentID = parent.data.TraceID, parent.data.SpanID
+	} else {
+		span.data.TraceID = randomId(16)
+	}
+	span.SetAttributes(attributes...)
+	return ContextWithSpan(ctx, span), span
+}
+
+// Start starts a child of the span in ctx using the span's tracer
+// If ctx has no span, nothing is traced and a nil span is returned, which is safe to use
+func Start(ctx context.Context, name string, attributes ...any) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, attributes...)
+}
+
+// Span is a single timed operation of a trace
+// Every method is safe to call on a nil span, in which case nothing is recorded
+type Span struct {
+	tracer *Tracer
+	mutex  sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// TraceID returns the ID of the trace the span belongs to
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.data.TraceID
+}
+
+// SpanID returns the ID of the span
+func (s *Span) SpanID() string {
+	if s == nil {
+		return ""
+	}
+	return s.data.SpanID
+}
+
+// SetAttributes sets attributes given as alternating keys and values
+func (s *Span) SetAttributes(attributes ...any) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := 0; i+1 < len(attributes); i += 2 {
+		s.data.Attributes[fmt.Sprint(attributes[i])] = attributes[i+1]
+	}
+}
+
+// RecordError marks the span as failed with the error, nil errors are ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End ends the span and passes it to the exporter, only the first call has any effect
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	data.Attributes = make(map[string]any, len(s.data.Attributes))
+	for key, value := range s.data.Attributes {
+		data.Attributes[key] = value
+	}
+	s.mutex.Unlock()
+	if s.tracer.exporter != nil {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a context carrying the span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span carried by the context, or nil if there is none
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// randomId returns a random hex ID of the given number of bytes
+func randomId(length int) string {
+	bytes := make([]byte, length)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(bytes)
+}
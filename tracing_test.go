@@ -0,0 +1,122 @@
+package fuse
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/glebarez/sqlite"
+	"github.com/sylvrs/fuse/tracing"
+)
+
+type tracedConfig struct {
+	ServiceConfiguration
+	Prefix string
+}
+
+func newTracedGuildManager(t *testing.T, exporter tracing.Exporter) *GuildManager {
+	t.Helper()
+	mng, err := NewManager(sqlite.Open(":memory:"), nil, &Config{Token: "token", Tracer: tracing.NewTracer(exporter)})
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := mng.connection.AutoMigrate(&GuildConfiguration{}, &AuditEntry{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if err := mng.session.State.GuildAdd(&discordgo.Guild{ID: "1"}); err != nil {
+		t.Fatalf("failed to add guild: %v", err)
+	}
+	guildManager, err := CreateGuildManager(mng, &GuildConfiguration{GuildID: "1"})
+	if err != nil {
+		t.Fatalf("failed to create guild manager: %v", err)
+	}
+	return guildManager
+}
+
+// childrenOf returns the names of the spans whose parent is the span with the given ID
+func childrenOf(spans []tracing.SpanData, parentId string) []string {
+	names := make([]string, 0)
+	for _, span := range spans {
+		if span.ParentID == parentId {
+			names = append(names, span.Name)
+		}
+	}
+	return names
+}
+
+func findSpan(t *testing.T, spans []tracing.SpanData, name string) tracing.SpanData {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no span named %q in %v", name, spans)
+	return tracing.SpanData{}
+}
+
+func TestContextVariantsAreTraced(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	mng := newTracedGuildManager(t, exporter)
+
+	ctx, root := mng.manager.Tracer().Start(context.Background(), "command test")
+	var config tracedConfig
+	if err := mng.FetchServiceConfigContext(ctx, &config); err != nil {
+		t.Fatalf("failed to fetch config: %v", err)
+	}
+	config.Prefix = "!"
+	if err := mng.SaveServiceConfigContext(ctx, &config); err != nil {
+		t.Fatalf("failed to save config: %v", err)
+	}
+	if _, err := mng.AuditContext(ctx, AuditEvent{Action: "settings.update"}); err != nil {
+		t.Fatalf("failed to audit: %v", err)
+	}
+	root.End()
+
+	spans := exporter.Spans()
+	rootData := findSpan(t, spans, "command test")
+	for _, span := range spans {
+		if span.TraceID != rootData.TraceID {
+			t.Errorf("span %q is not part of the root trace", span.Name)
+		}
+	}
+	children := childrenOf(spans, rootData.SpanID)
+	for _, name := range []string{"config fetch", "config save", "audit"} {
+		found := false
+		for _, child := range children {
+			found = found || child == name
+		}
+		if !found {
+			t.Errorf("expected %q to be a child of the root span, got %v", name, children)
+		}
+	}
+	for _, name := range []string{"config fetch", "config save", "audit"} {
+		span := findSpan(t, spans, name)
+		if len(childrenOf(spans, span.SpanID)) == 0 {
+			t.Errorf("expected %q to have database spans", name)
+		}
+	}
+}
+
+func TestCachedFetchIsTraced(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	mng := newTracedGuildManager(t, exporter)
+
+	var config tracedConfig
+	if err := mng.FetchServiceConfig(&config); err != nil {
+		t.Fatalf("failed to fetch config: %v", err)
+	}
+	ctx, root := mng.manager.Tracer().Start(context.Background(), "command test")
+	if err := mng.FetchServiceConfigContext(ctx, &config); err != nil {
+		t.Fatalf("failed to fetch config: %v", err)
+	}
+	root.End()
+
+	span := findSpan(t, exporter.Spans(), "config fetch")
+	if span.Attributes["config.cached"] != true {
+		t.Errorf("expected the second fetch to be served from the cache, got attributes %v", span.Attributes)
+	}
+	if children := childrenOf(exporter.Spans(), span.SpanID); len(children) != 0 {
+		t.Errorf("expected no database spans for a cached fetch, got %v", children)
+	}
+}
@@ -0,0 +1,23 @@
+package utils
+
+import "github.com/bwmarrin/discordgo"
+
+// InteractionUser returns the user who triggered the interaction
+// Interactions in guilds only carry a member while interactions in DMs only carry a user
+func InteractionUser(i *discordgo.Interaction) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// EphemeralResponse creates a response that sends an ephemeral message with the given embed
+func EphemeralResponse(embed *discordgo.MessageEmbed) *discordgo.InteractionResponse {
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags:  discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{embed},
+		},
+	}
+}
@@ -1,16 +1,20 @@
 package utils
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
-	log "github.com/inconshreveable/log15"
 	"golang.org/x/exp/slices"
 )
 
 var (
 	// The keys to strip from the log output when logging to Discord
-	excludedLoggingKeys = []string{"fn"}
+	excludedLoggingKeys = []string{"fn", SkipDiscordLogKey}
 )
 
 const (
@@ -22,46 +26,333 @@ const (
 	ColorNeutral = 0x808080
 )
 
-func embedOptionsByLevel(lvl log.Lvl) (string, int) {
-	switch lvl {
-	case log.LvlInfo:
-		return "Info", ColorInfo
-	case log.LvlWarn:
-		return "Warn", ColorWarning
-	case log.LvlError:
-		return "Error", ColorError
-	case log.LvlCrit:
-		return "Critical", ColorError
+const (
+	// SkipDiscordLogKey is a context key that keeps a record from being sent to Discord
+	// It should be used when logging failures of the Discord log handler itself so that they cannot recurse
+	// e.g. logger.Error("Failed to send logs", utils.SkipDiscordLogKey, true, "error", err)
+	SkipDiscordLogKey = "skip_discord"
+	// maxEmbedsPerMessage is the maximum number of embeds Discord allows in a single message
+	maxEmbedsPerMessage = 10
+	// maxEmbedsLength is the maximum combined length of all embeds in a single message allowed by Discord
+	maxEmbedsLength = 6000
+	// maxLogDescriptionLength and maxLogFieldLength keep single records from using up a whole message
+	maxLogDescriptionLength = 1024
+	maxLogFieldLength       = 256
+	maxLogFields            = 10
+)
+
+// DiscordLogOptions configures a Discord log handler
+type DiscordLogOptions struct {
+	// Level is the least severe level that is sent, e.g. slog.LevelWarn only sends warnings and errors
+	Level slog.Level
+	// QueueSize is the number of records that can wait to be sent before new records are dropped
+	QueueSize int
+	// FlushInterval is how often queued records are sent
+	FlushInterval time.Duration
+	// CoalesceWindow is how long repeats of a message are counted instead of being sent
+	// Once the window has passed, a single summary of the repeats is sent. If zero, repeats are always sent
+	CoalesceWindow time.Duration
+	// OnError is called when sending a batch of records fails
+	// If it logs the error through a logger using this handler, SkipDiscordLogKey must be set
+	OnError func(err error)
+}
+
+// DefaultDiscordLogOptions returns the options used by NewDiscordLogHandler when none are provided
+func DefaultDiscordLogOptions() DiscordLogOptions {
+	return DiscordLogOptions{
+		Level:          slog.LevelInfo,
+		QueueSize:      256,
+		FlushInterval:  2 * time.Second,
+		CoalesceWindow: time.Minute,
+	}
+}
+
+// DiscordLogHandler is a slog handler that sends records as embeds to a Discord channel
+// Records are queued and sent in the background in batches, so logging never waits on Discord
+// When the queue is full, records are dropped and the number of dropped records is reported in the next batch
+type DiscordLogHandler struct {
+	sink   *discordLogSink
+	attrs  []slog.Attr
+	prefix string
+}
+
+// discordLogSink queues and sends the records of a handler and every handler derived from it
+type discordLogSink struct {
+	session   *discordgo.Session
+	channelId string
+	options   DiscordLogOptions
+	queue     chan *queuedRecord
+	dropped   atomic.Uint64
+	reported  uint64
+	failed    atomic.Uint64
+	repeats   map[string]*repeatedRecord
+	pending   []*discordgo.MessageEmbed
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// queuedRecord is a record along with the attributes added to the handler that received it
+type queuedRecord struct {
+	record slog.Record
+	attrs  []slog.Attr
+	prefix string
+}
+
+// repeatedRecord counts the repeats of a message within the coalesce window
+type repeatedRecord struct {
+	since  time.Time
+	count  int
+	record *queuedRecord
+}
+
+// NewDiscordLogHandler creates a handler that sends records to the channel and starts sending in the background
+// The handler must be closed once it is no longer used
+func NewDiscordLogHandler(s *discordgo.Session, guildId, channelId string, options ...DiscordLogOptions) *DiscordLogHandler {
+	opts := DefaultDiscordLogOptions()
+	if len(options) != 0 {
+		opts = options[0]
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultDiscordLogOptions().QueueSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultDiscordLogOptions().FlushInterval
+	}
+	sink := &discordLogSink{
+		session:   s,
+		channelId: channelId,
+		options:   opts,
+		queue:     make(chan *queuedRecord, opts.QueueSize),
+		repeats:   make(map[string]*repeatedRecord),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go sink.run()
+	return &DiscordLogHandler{sink: sink}
+}
+
+// Enabled reports whether records of the level are sent
+func (h *DiscordLogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.sink.options.Level
+}
+
+// Handle queues the record to be sent, dropping it if the queue is full
+func (h *DiscordLogHandler) Handle(_ context.Context, r slog.Record) error {
+	if !h.Enabled(context.Background(), r.Level) || h.skipsDiscord(r) {
+		return nil
+	}
+	select {
+	case h.sink.queue <- &queuedRecord{record: r.Clone(), attrs: h.attrs, prefix: h.prefix}:
 	default:
-		return "Unknown", ColorNeutral
+		h.sink.dropped.Add(1)
+	}
+	return nil
+}
+
+// WithAttrs returns a handler that adds the attributes to every record, sharing the queue of this handler
+func (h *DiscordLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefixed := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		prefixed[i] = slog.Attr{Key: h.prefix + attr.Key, Value: attr.Value}
+	}
+	return &DiscordLogHandler{sink: h.sink, attrs: append(slices.Clip(h.attrs), prefixed...), prefix: h.prefix}
+}
+
+// WithGroup returns a handler that prefixes the keys of the following attributes with the group name
+func (h *DiscordLogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
 	}
+	return &DiscordLogHandler{sink: h.sink, attrs: h.attrs, prefix: h.prefix + name + "."}
 }
 
-func NewDiscordLogHandler(s *discordgo.Session, guildId, channelId string) log.Handler {
-	return log.FuncHandler(func(r *log.Record) error {
-		title, color := embedOptionsByLevel(r.Lvl)
+// Dropped returns the number of records that were dropped because the queue was full
+func (h *DiscordLogHandler) Dropped() uint64 {
+	return h.sink.dropped.Load()
+}
 
-		fields := make([]*discordgo.MessageEmbedField, 0)
+// Failed returns the number of batches that could not be sent
+func (h *DiscordLogHandler) Failed() uint64 {
+	return h.sink.failed.Load()
+}
 
-		// iterate through context and add fields (2 at a time)
-		if (len(r.Ctx) % 2) == 0 {
-			for i := 0; i < len(r.Ctx); i += 2 {
-				if key, ok := r.Ctx[i].(string); ok && slices.Contains(excludedLoggingKeys, key) {
-					continue
+// Close stops the handler and every handler derived from it after sending the queued records
+func (h *DiscordLogHandler) Close() {
+	h.sink.closeOnce.Do(func() {
+		close(h.sink.stop)
+		<-h.sink.done
+	})
+}
+
+// skipsDiscord returns true if the record or the handler carries SkipDiscordLogKey
+func (h *DiscordLogHandler) skipsDiscord(r slog.Record) bool {
+	for _, attr := range h.attrs {
+		if attr.Key == SkipDiscordLogKey {
+			return true
+		}
+	}
+	skip := false
+	r.Attrs(func(attr slog.Attr) bool {
+		skip = attr.Key == SkipDiscordLogKey
+		return !skip
+	})
+	return skip
+}
+
+func (s *discordLogSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.options.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case r := <-s.queue:
+			s.add(r, time.Now())
+			if len(s.pending) >= maxEmbedsPerMessage {
+				s.flush(time.Now(), false)
+			}
+		case now := <-ticker.C:
+			s.flush(now, false)
+		case <-s.stop:
+			for {
+				select {
+				case r := <-s.queue:
+					s.add(r, time.Now())
+				default:
+					s.flush(time.Now(), true)
+					return
 				}
-				fields = append(fields, &discordgo.MessageEmbedField{
-					Name:  fmt.Sprintf("%v", r.Ctx[i]),
-					Value: fmt.Sprintf("%v", r.Ctx[i+1]),
-				})
 			}
 		}
+	}
+}
 
-		_, _ = s.ChannelMessageSendEmbed(channelId, &discordgo.MessageEmbed{
-			Title:       fmt.Sprintf("Logger | %s", title),
-			Description: r.Msg,
-			Color:       color,
-			Fields:      fields,
+// add turns the record into an embed, unless it repeats a message sent within the coalesce window
+func (s *discordLogSink) add(r *queuedRecord, now time.Time) {
+	if s.options.CoalesceWindow > 0 {
+		key := fmt.Sprintf("%d:%s", r.record.Level, r.record.Message)
+		if repeated, ok := s.repeats[key]; ok {
+			repeated.count++
+			repeated.record = r
+			return
+		}
+		s.repeats[key] = &repeatedRecord{since: now}
+	}
+	s.pending = append(s.pending, recordEmbed(r))
+}
+
+// flush sends the pending embeds along with the summaries of repeats whose window has passed
+// If final is set, every summary is sent regardless of its window
+func (s *discordLogSink) flush(now time.Time, final bool) {
+	for key, repeated := range s.repeats {
+		if !final && now.Sub(repeated.since) < s.options.CoalesceWindow {
+			continue
+		}
+		delete(s.repeats, key)
+		if repeated.count == 0 {
+			continue
+		}
+		embed := recordEmbed(repeated.record)
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("x%d in the last %s", repeated.count, now.Sub(repeated.since).Round(time.Second))}
+		s.pending = append(s.pending, embed)
+	}
+	if dropped := s.dropped.Load(); dropped != s.reported {
+		s.pending = append(s.pending, &discordgo.MessageEmbed{
+			Title:       "Logger | Dropped",
+			Description: fmt.Sprintf("%d %s dropped as they were logged faster than they could be sent.", dropped-s.reported, Pluralize(int(dropped-s.reported), "log record was", "log records were")),
+			Color:       ColorNeutral,
 		})
-		return nil
+		s.reported = dropped
+	}
+
+	for len(s.pending) != 0 {
+		count, length := 0, 0
+		for count < len(s.pending) && count < maxEmbedsPerMessage {
+			embedLength := embedLength(s.pending[count])
+			if count != 0 && length+embedLength > maxEmbedsLength {
+				break
+			}
+			length += embedLength
+			count++
+		}
+		batch := s.pending[:count]
+		s.pending = s.pending[count:]
+		if _, err := s.session.ChannelMessageSendEmbeds(s.channelId, batch); err != nil {
+			s.failed.Add(1)
+			if s.options.OnError != nil {
+				s.options.OnError(err)
+			}
+		}
+	}
+}
+
+func embedOptionsByLevel(level slog.Level) (string, int) {
+	switch {
+	case level > slog.LevelError:
+		return "Critical", ColorError
+	case level == slog.LevelError:
+		return "Error", ColorError
+	case level >= slog.LevelWarn:
+		return "Warn", ColorWarning
+	case level >= slog.LevelInfo:
+		return "Info", ColorInfo
+	default:
+		return "Debug", ColorNeutral
+	}
+}
+
+// recordEmbed creates the embed for a single record
+func recordEmbed(r *queuedRecord) *discordgo.MessageEmbed {
+	title, color := embedOptionsByLevel(r.record.Level)
+
+	fields := make([]*discordgo.MessageEmbedField, 0)
+	addField := func(attr slog.Attr) bool {
+		if len(fields) == maxLogFields {
+			return false
+		}
+		if slices.Contains(excludedLoggingKeys, attr.Key) {
+			return true
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  Truncate(attr.Key, maxLogFieldLength),
+			Value: Truncate(attr.Value.Resolve().String(), maxLogFieldLength),
+		})
+		return true
+	}
+	for _, attr := range r.attrs {
+		addField(attr)
+	}
+	r.record.Attrs(func(attr slog.Attr) bool {
+		attr.Key = r.prefix + attr.Key
+		return addField(attr)
 	})
+
+	return &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Logger | %s", title),
+		Description: Truncate(r.record.Message, maxLogDescriptionLength),
+		Color:       color,
+		Fields:      fields,
+		Timestamp:   r.record.Time.Format(time.RFC3339),
+	}
+}
+
+// embedLength returns the length of the embed as counted towards Discord's limit
+func embedLength(embed *discordgo.MessageEmbed) int {
+	length := len(embed.Title) + len(embed.Description)
+	for _, field := range embed.Fields {
+		length += len(field.Name) + len(field.Value)
+	}
+	if embed.Footer != nil {
+		length += len(embed.Footer.Text)
+	}
+	return length
+}
+
+// Truncate shortens the text to at most length runes, ending it with an ellipsis if it was cut
+func Truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-3]) + "..."
 }
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"golang.org/x/exp/slices"
+)
+
+// recordingTransport records the embeds of every message sent through it instead of sending them to Discord
+type recordingTransport struct {
+	mutex    sync.Mutex
+	messages [][]*discordgo.MessageEmbed
+}
+
+func (t *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body struct {
+		Embeds []*discordgo.MessageEmbed `json:"embeds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	t.mutex.Lock()
+	t.messages = append(t.messages, body.Embeds)
+	t.mutex.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader("{}")),
+		Request:    r,
+	}, nil
+}
+
+// logToDiscord logs the records through a Discord log handler and returns the messages it sent once closed
+func logToDiscord(t *testing.T, coalesceWindow time.Duration, log func(logger *slog.Logger)) [][]*discordgo.MessageEmbed {
+	t.Helper()
+	session, err := discordgo.New("Bot token")
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	transport := &recordingTransport{}
+	session.Client = &http.Client{Transport: transport}
+	options := DefaultDiscordLogOptions()
+	options.Level = slog.LevelDebug
+	options.FlushInterval = time.Hour
+	options.CoalesceWindow = coalesceWindow
+	options.OnError = func(err error) {
+		t.Errorf("failed to send logs: %v", err)
+	}
+	handler := NewDiscordLogHandler(session, "1", "2", options)
+	log(slog.New(handler))
+	handler.Close()
+	return transport.messages
+}
+
+func TestDiscordLogBatching(t *testing.T) {
+	longMessage := strings.Repeat("a", maxLogDescriptionLength)
+	longValue := strings.Repeat("b", maxLogFieldLength)
+	tests := []struct {
+		name    string
+		records int
+		// message and attrs are logged for every record
+		message string
+		attrs   []any
+		// expected is the number of embeds expected in each sent message
+		expected []int
+	}{
+		{"single record", 1, "", nil, []int{1}},
+		{"full message", maxEmbedsPerMessage, "", nil, []int{10}},
+		{"split by count", 25, "", nil, []int{10, 10, 5}},
+		// each embed is just over 2000 characters long, so only two fit in 6000 characters
+		{"split by length", 5, longMessage, []any{"a", longValue, "b", longValue, "c", longValue, "d", longValue}, []int{2, 2, 1}},
+		// an embed of over 6000 characters is still sent on its own
+		{"oversized embed", 2, longMessage, []any{
+			"a1", longValue, "a2", longValue, "a3", longValue, "a4", longValue, "a5", longValue,
+			"a6", longValue, "a7", longValue, "a8", longValue, "a9", longValue, "a10", longValue,
+		}, []int{1, 1}},
+	}
+	for _, test := range tests {
+		messages := logToDiscord(t, 0, func(logger *slog.Logger) {
+			for i := 0; i < test.records; i++ {
+				logger.Info(test.message+strings.Repeat("!", i), test.attrs...)
+			}
+		})
+		counts := make([]int, len(messages))
+		for i, embeds := range messages {
+			counts[i] = len(embeds)
+			length := 0
+			for _, embed := range embeds {
+				length += embedLength(embed)
+			}
+			if len(embeds) > 1 && length > maxEmbedsLength {
+				t.Errorf("%s: message %d is %d characters long", test.name, i, length)
+			}
+		}
+		if !slices.Equal(counts, test.expected) {
+			t.Errorf("%s: sent messages with %v embeds, expected %v", test.name, counts, test.expected)
+		}
+	}
+}
+
+func TestDiscordLogCoalescing(t *testing.T) {
+	tests := []struct {
+		name   string
+		window time.Duration
+		log    func(logger *slog.Logger)
+		// expected is the description of every sent embed, followed by its footer if it has one
+		expected []string
+	}{
+		{"repeats are coalesced", time.Hour, func(logger *slog.Logger) {
+			logger.Info("repeated")
+			logger.Info("repeated")
+			logger.Info("repeated")
+			logger.Info("other")
+		}, []string{"repeated", "other", "repeated x2"}},
+		{"levels are coalesced separately", time.Hour, func(logger *slog.Logger) {
+			logger.Info("repeated")
+			logger.Warn("repeated")
+			logger.Info("repeated")
+		}, []string{"repeated", "repeated", "repeated x1"}},
+		{"single records have no summary", time.Hour, func(logger *slog.Logger) {
+			logger.Info("once")
+		}, []string{"once"}},
+		{"repeats are sent without a window", 0, func(logger *slog.Logger) {
+			logger.Info("repeated")
+			logger.Info("repeated")
+		}, []string{"repeated", "repeated"}},
+	}
+	for _, test := range tests {
+		messages := logToDiscord(t, test.window, test.log)
+		sent := make([]string, 0)
+		for _, embeds := range messages {
+			for _, embed := range embeds {
+				description := embed.Description
+				if embed.Footer != nil {
+					description += " " + strings.Fields(embed.Footer.Text)[0]
+				}
+				sent = append(sent, description)
+			}
+		}
+		if !slices.Equal(sent, test.expected) {
+			t.Errorf("%s: sent %q, expected %q", test.name, sent, test.expected)
+		}
+	}
+}
+
+func TestDiscordLogSkip(t *testing.T) {
+	messages := logToDiscord(t, 0, func(logger *slog.Logger) {
+		logger.Info("sent")
+		logger.Info("skipped", SkipDiscordLogKey, true)
+		logger.With(SkipDiscordLogKey, true).Info("skipped")
+	})
+	if len(messages) != 1 || len(messages[0]) != 1 || messages[0][0].Description != "sent" {
+		t.Errorf("expected only the record without %s to be sent, got %v", SkipDiscordLogKey, messages)
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ParseTag parses a struct tag in the same format as gorm (e.g. `description:The channel to use;min:1;required`)
+// Keys are lowercased and flags without a value are mapped to an empty string
+func ParseTag(tag string) map[string]string {
+	settings := make(map[string]string)
+	for _, part := range strings.Split(tag, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(part, ":")
+		settings[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	return settings
+}
+
+// SnakeCase converts a Go identifier such as `WelcomeChannelID` into `welcome_channel_id`
+func SnakeCase(name string) string {
+	return strings.ToLower(splitWords(name, "_"))
+}
+
+// HumanCase converts a Go identifier such as `WelcomeChannelID` into `Welcome Channel ID`
+func HumanCase(name string) string {
+	return splitWords(name, " ")
+}
+
+// splitWords inserts the separator between every word of a camel-cased identifier
+func splitWords(name, separator string) string {
+	runes := []rune(name)
+	var builder strings.Builder
+	for i, r := range runes {
+		if r == '_' {
+			builder.WriteString(separator)
+			continue
+		}
+		// a new word starts after a lowercase rune or at the last uppercase rune of an acronym (e.g. the `C` in `IDCard`)
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || (unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			builder.WriteString(separator)
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
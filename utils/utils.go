@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 
 	"github.com/bwmarrin/discordgo"
@@ -107,3 +109,12 @@ func Remove[T comparable](array []T, value T) ([]T, error) {
 func IntPtr[T int64](i T) *T {
 	return &i
 }
+
+// RandomId returns a random hexadecimal string that is `length` bytes long before encoding
+func RandomId(length int) string {
+	bytes := make([]byte, length)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(bytes)
+}